@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/korylprince/snmp-tracker/snmp"
+)
+
+type portState struct {
+	Status      string    `json:"status"`
+	AdminStatus string    `json:"admin_status"`
+	Speed       int       `json:"speed"`
+	FirstSeen   time.Time `json:"first_seen"`
+}
+
+type macAddressState struct {
+	Port      string    `json:"port"`
+	FirstSeen time.Time `json:"first_seen"`
+}
+
+// ChangeTracker keeps the state of ports and MAC addresses from the previous poll of each system,
+// so that port and MAC address journals are recorded as intervals that only start on a transition
+// (link up/down, admin up/down, speed change, MAC address appeared or moved) instead of a new sample every poll.
+// Unchanged records keep their original time and only have last_seen updated
+type ChangeTracker struct {
+	path string
+	// Ports is keyed by system chassis ID or name, then port name
+	Ports map[string]map[string]*portState `json:"ports"`
+	// MacAddresses is keyed by system chassis ID or name, then MAC address and VLAN
+	MacAddresses map[string]map[string]*macAddressState `json:"mac_addresses"`
+}
+
+// NewChangeTracker returns a new ChangeTracker. If path is not empty, state is loaded from and saved to path
+func NewChangeTracker(path string) (*ChangeTracker, error) {
+	c := &ChangeTracker{
+		path:         path,
+		Ports:        make(map[string]map[string]*portState),
+		MacAddresses: make(map[string]map[string]*macAddressState),
+	}
+	if path == "" {
+		return c, nil
+	}
+
+	buf, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read state: %w", err)
+	}
+	if err = json.Unmarshal(buf, c); err != nil {
+		return nil, fmt.Errorf("Unable to decode state: %w", err)
+	}
+
+	return c, nil
+}
+
+// Save saves the state to disk
+func (c *ChangeTracker) Save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	buf, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("Unable to encode state: %w", err)
+	}
+
+	tmp := filepath.Join(filepath.Dir(c.path), "."+filepath.Base(c.path))
+	if err = os.WriteFile(tmp, buf, 0o600); err != nil {
+		return fmt.Errorf("Unable to write state: %w", err)
+	}
+	if err = os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("Unable to rename state: %w", err)
+	}
+
+	return nil
+}
+
+// Apply rewrites the port and MAC address journals in j from samples to intervals, and updates the state
+// of every system with ports in j. Systems that weren't polled keep their previous state, and systems whose
+// MAC address collector failed keep their previous MAC address state
+func (c *ChangeTracker) Apply(j *Journal) {
+	ports := make(map[string]map[string]*portState)
+	macs := make(map[string]map[string]*macAddressState)
+
+	macFailed := make(map[string]bool)
+	for _, e := range j.CollectorErrors {
+		if e.Collector == snmp.CollectorMacAddress {
+			macFailed[e.System.Data.key()] = true
+		}
+	}
+
+	for _, pj := range j.Ports {
+		sys, name := pj.Port.Data.System.Data.key(), pj.Port.Data.Name
+		if ports[sys] == nil {
+			ports[sys] = make(map[string]*portState)
+			macs[sys] = make(map[string]*macAddressState)
+		}
+
+		state := &portState{Status: pj.Status, AdminStatus: pj.AdminStatus, Speed: pj.Speed, FirstSeen: *pj.Time}
+		if prev, ok := c.Ports[sys][name]; ok && prev.Status == state.Status && prev.AdminStatus == state.AdminStatus && prev.Speed == state.Speed {
+			state.FirstSeen = prev.FirstSeen
+		}
+		ports[sys][name] = state
+
+		first := state.FirstSeen
+		pj.LastSeen = pj.Time
+		pj.Time = &first
+	}
+
+	for _, mj := range j.MacAddresses {
+		if mj.Port == nil {
+			continue
+		}
+		sys, port := mj.Port.Data.System.Data.key(), mj.Port.Data.Name
+		if macs[sys] == nil {
+			macs[sys] = make(map[string]*macAddressState)
+		}
+		key := fmt.Sprintf("%s/%d", mj.MacAddress.Data.MacAddress, mj.Vlan)
+
+		state := &macAddressState{Port: port, FirstSeen: *mj.Time}
+		if prev, ok := c.MacAddresses[sys][key]; ok && prev.Port == port {
+			state.FirstSeen = prev.FirstSeen
+		}
+		macs[sys][key] = state
+
+		first := state.FirstSeen
+		mj.LastSeen = mj.Time
+		mj.Time = &first
+	}
+
+	for sys, p := range ports {
+		c.Ports[sys] = p
+		if !macFailed[sys] {
+			c.MacAddresses[sys] = macs[sys]
+		}
+	}
+
+	j.Intervals = true
+}
@@ -82,7 +82,7 @@ func translate(sys []*system) []*System {
 
 const gqlInsert = `
 	mutation insert_systems($systems: [system_insert_input!]!) {
-	  insert_system(objects: $systems, on_conflict: {constraint: unique_system_name, update_columns: [name, hostname_id, connection_id, port]}) {
+	  insert_system(objects: $systems, on_conflict: {constraint: unique_system_identity, update_columns: [name, hostname_id, connection_id, port]}) {
 		affected_rows
 	  }
 	}
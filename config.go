@@ -4,12 +4,28 @@ import "time"
 
 // Config configures snmp-tracker
 type Config struct {
-	GraphQLEndpoint    string `required:"true"`
-	GraphQLAdminSecret string
-	GraphQLAPISecret   string
-	SNMPWorkers        int           `default:"10"`
-	Resolvers          int           `default:"16"`
-	ResolveBuffers     int           `default:"1024"`
-	PollInterval       time.Duration `default:"30m"`
-	DebugPath          string
+	GraphQLEndpoint       string `required:"true"`
+	GraphQLAdminSecret    string
+	GraphQLAPISecret      string
+	SNMPWorkers           int           `default:"10"`
+	Resolvers             int           `default:"16"`
+	ResolveBuffers        int           `default:"1024"`
+	PollInterval          time.Duration `default:"30m"`
+	PollBackoffMax        time.Duration `default:"24h"`
+	SystemRefreshInterval time.Duration `default:"5m"`
+	DeviceTimeout         time.Duration `default:"10m"`
+	ShutdownTimeout       time.Duration `default:"1m"`
+	DebugPath             string
+	MetricsAddr           string
+	SpoolPath             string
+	SpoolMaxSize          int64         `default:"1073741824"`
+	SpoolMaxAge           time.Duration `default:"168h"`
+	InsertChunkSize       int           `default:"0"`
+	InsertRetries         int           `default:"2"`
+	ChangeOnly            bool
+	ChangeStatePath       string
+	ChangeStateInterval   time.Duration `default:"5m"`
+	TrapAddr              string
+	TrapCommunity         string
+	TrapPollDelay         time.Duration `default:"10s"`
 }
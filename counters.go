@@ -0,0 +1,151 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// counterSampleMaxAge is how long the samples of a system that's no longer polled are kept
+const counterSampleMaxAge = 7 * 24 * time.Hour
+
+type counterSample struct {
+	time     time.Time
+	counters *PortCounterJournal
+}
+
+// CounterTracker keeps the previous counter sample of each port in memory to compute rates between polls
+type CounterTracker struct {
+	//samples is keyed by system chassis ID or name, then ifIndex, since port names aren't always unique
+	samples map[string]map[int]*counterSample
+}
+
+// NewCounterTracker returns a new CounterTracker
+func NewCounterTracker() *CounterTracker {
+	return &CounterTracker{samples: make(map[string]map[int]*counterSample)}
+}
+
+type counterPair struct {
+	prev uint64
+	cur  uint64
+	bits int
+}
+
+// delta returns the increase of a counter with the given width. A 32 bit counter that decreased is assumed to have
+// wrapped once, unless the wrapped increase is more than half the counter range, e.g. after clear counters.
+// A 64 bit counter can't wrap between polls, so a decrease means it was reset. False is returned on a reset
+func (c *counterPair) delta() (uint64, bool) {
+	if c.cur >= c.prev {
+		return c.cur - c.prev, true
+	}
+	if c.bits == 32 && c.prev <= math.MaxUint32 {
+		if d := c.cur + (math.MaxUint32 - c.prev) + 1; d <= math.MaxUint32/2 {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// counterValue returns the value of a counter the device may not report, or 0
+func counterValue(v *uint64) uint64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+// Apply sets the rates of the port counter journals in j from the previous samples, and replaces the samples of
+// every system with counters in j. Rates aren't set for a port's first sample, or if the system rebooted or a counter
+// was reset since the previous sample
+func (c *CounterTracker) Apply(j *Journal) {
+	samples := make(map[string]map[int]*counterSample)
+	for _, pc := range j.PortCounters {
+		sys := pc.Port.Data.System.Data.key()
+		if samples[sys] == nil {
+			samples[sys] = make(map[int]*counterSample)
+		}
+		samples[sys][pc.ifIndex] = &counterSample{time: *pc.Time, counters: pc}
+
+		prev, ok := c.samples[sys][pc.ifIndex]
+		if !ok {
+			continue
+		}
+
+		interval := pc.Time.Sub(prev.time).Seconds()
+		//the system rebooted if it's been up for less time than since the previous sample
+		if interval <= 0 || pc.uptime > 0 && pc.uptime < pc.Time.Sub(prev.time) || pc.bits != prev.counters.bits {
+			continue
+		}
+
+		p := prev.counters
+		//error and discard counters are always 32 bits. With 64 bit counters, packets are summed before the delta
+		//since they can't wrap; 32 bit unicast and non-unicast counters are wrapped individually
+		inPackets := []*counterPair{{p.InUnicastPackets, pc.InUnicastPackets, pc.bits}}
+		outPackets := []*counterPair{{p.OutUnicastPackets, pc.OutUnicastPackets, pc.bits}}
+		if pc.bits == 64 {
+			inPackets[0].prev += counterValue(p.InMulticastPackets) + counterValue(p.InBroadcastPackets)
+			inPackets[0].cur += counterValue(pc.InMulticastPackets) + counterValue(pc.InBroadcastPackets)
+			outPackets[0].prev += counterValue(p.OutMulticastPackets) + counterValue(p.OutBroadcastPackets)
+			outPackets[0].cur += counterValue(pc.OutMulticastPackets) + counterValue(pc.OutBroadcastPackets)
+		} else {
+			if p.inNonUnicast != nil && pc.inNonUnicast != nil {
+				inPackets = append(inPackets, &counterPair{*p.inNonUnicast, *pc.inNonUnicast, 32})
+			}
+			if p.outNonUnicast != nil && pc.outNonUnicast != nil {
+				outPackets = append(outPackets, &counterPair{*p.outNonUnicast, *pc.outNonUnicast, 32})
+			}
+		}
+		deltas := [][]*counterPair{
+			{{p.InOctets, pc.InOctets, pc.bits}},
+			{{p.OutOctets, pc.OutOctets, pc.bits}},
+			inPackets,
+			outPackets,
+			{{p.InErrors, pc.InErrors, 32}},
+			{{p.OutErrors, pc.OutErrors, 32}},
+			{{p.InDiscards, pc.InDiscards, 32}},
+			{{p.OutDiscards, pc.OutDiscards, 32}},
+		}
+
+		rates := make([]float64, len(deltas))
+		reset := false
+		for i, pairs := range deltas {
+			for _, d := range pairs {
+				delta, ok := d.delta()
+				if !ok {
+					reset = true
+					break
+				}
+				rates[i] += float64(delta) / interval
+			}
+		}
+		if reset {
+			continue
+		}
+
+		inBPS, outBPS := rates[0]*8, rates[1]*8
+		pc.Interval = &interval
+		pc.InBitsPerSecond, pc.OutBitsPerSecond = &inBPS, &outBPS
+		pc.InPacketsPerSecond, pc.OutPacketsPerSecond = &rates[2], &rates[3]
+		pc.InErrorsPerSecond, pc.OutErrorsPerSecond = &rates[4], &rates[5]
+		pc.InDiscardsPerSecond, pc.OutDiscardsPerSecond = &rates[6], &rates[7]
+
+		//speed is in Mbps
+		if pc.speed > 0 {
+			in, out := inBPS/float64(pc.speed*1000000)*100, outBPS/float64(pc.speed*1000000)*100
+			pc.InUtilization, pc.OutUtilization = &in, &out
+		}
+	}
+
+	for sys, s := range samples {
+		c.samples[sys] = s
+	}
+
+	//drop systems that are no longer polled. All samples of a system are from the same poll, so only one is checked
+	for sys, s := range c.samples {
+		for _, sample := range s {
+			if time.Since(sample.time) > counterSampleMaxAge {
+				delete(c.samples, sys)
+			}
+			break
+		}
+	}
+}
@@ -3,10 +3,12 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,11 +19,16 @@ import (
 const gqlReadSystems = `
 	query read_systems {
 	  system(where: {connection_id: {_is_null: false}, hostname: {hostname: {_neq: ""}}, port: {_neq: 0}}) {
+		id
 		hostname {
 		  hostname
 		}
 		port
+		poll_interval
+		consecutive_failures
+		collect_optics
 		connection {
+		  version
 		  transport
 		  community
 		  timeout
@@ -46,15 +53,23 @@ mutation insert_journals(
   $lldps: [lldp_journal_insert_input!]!,
   $mac_addresses: [mac_address_journal_insert_input!]!,
   $arps: [arp_journal_insert_input!]!,
-  $resolves: [resolve_journal_insert_input!]!
+  $resolves: [resolve_journal_insert_input!]!,
+  $entities: [entity_journal_insert_input!]!,
+  $sensors: [sensor_journal_insert_input!]!,
+  $port_counters: [port_counter_journal_insert_input!]!,
+  $collector_errors: [collector_error_journal_insert_input!]!,
+  $polls: [system_poll_insert_input!]!,
+  $systems: [system_insert_input!]!,
+  $port_conflict: port_journal_on_conflict,
+  $mac_address_conflict: mac_address_journal_on_conflict
 ) {
-  insert_port_journal(objects: $ports) {
+  insert_port_journal(objects: $ports, on_conflict: $port_conflict) {
     affected_rows
   }
   insert_lldp_journal(objects: $lldps) {
     affected_rows
   }
-  insert_mac_address_journal(objects: $mac_addresses) {
+  insert_mac_address_journal(objects: $mac_addresses, on_conflict: $mac_address_conflict) {
     affected_rows
   }
   insert_arp_journal(objects: $arps) {
@@ -63,6 +78,24 @@ mutation insert_journals(
   insert_resolve_journal(objects: $resolves) {
     affected_rows
   }
+  insert_entity_journal(objects: $entities, on_conflict: {constraint: unique_entity_journal, update_columns: [last_seen]}) {
+    affected_rows
+  }
+  insert_sensor_journal(objects: $sensors) {
+    affected_rows
+  }
+  insert_port_counter_journal(objects: $port_counters) {
+    affected_rows
+  }
+  insert_collector_error_journal(objects: $collector_errors) {
+    affected_rows
+  }
+  insert_system_poll(objects: $polls) {
+    affected_rows
+  }
+  insert_system(objects: $systems, on_conflict: {constraint: unique_system_identity, update_columns: [name, hostname_id]}) {
+    affected_rows
+  }
 }
 `
 
@@ -75,11 +108,76 @@ func WithDebugPath(path string) Option {
 	}
 }
 
+// WithChunkSize sets the maximum number of records inserted per mutation. If n <= 0, Journals aren't split.
+// A system's records are never split across mutations, so a system with more than n records is inserted in a mutation
+// of its own
+func WithChunkSize(n int) Option {
+	return func(c *GraphQLConn) {
+		c.chunkSize = n
+	}
+}
+
+// WithRetries sets the number of times a failed chunk is retried
+func WithRetries(n int) Option {
+	return func(c *GraphQLConn) {
+		c.retries = n
+	}
+}
+
 // GraphQLConn is a GraphQL websocket connection
 type GraphQLConn struct {
 	conn      *graphql.Conn
 	mu        *sync.Mutex
 	debugPath string
+	chunkSize int
+	retries   int
+}
+
+// ChunkError is an error inserting a chunk of a Journal
+type ChunkError struct {
+	Chunk   int
+	Chunks  int
+	Journal *Journal
+	Err     error
+}
+
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("chunk %d/%d (%d records): %v", e.Chunk+1, e.Chunks, e.Journal.Len(), e.Err)
+}
+
+func (e *ChunkError) Unwrap() error {
+	return e.Err
+}
+
+// InsertError is returned from InsertJournal if one or more chunks failed to insert
+type InsertError struct {
+	Chunks []*ChunkError
+}
+
+func (e *InsertError) Error() string {
+	errs := make([]string, 0, len(e.Chunks))
+	for _, c := range e.Chunks {
+		errs = append(errs, c.Error())
+	}
+	return fmt.Sprintf("%d chunks failed: %s", len(e.Chunks), strings.Join(errs, "; "))
+}
+
+// Failed returns a Journal containing the records that failed to insert
+func (e *InsertError) Failed() *Journal {
+	j := NewJournal()
+	for _, c := range e.Chunks {
+		j.Merge(c.Journal)
+	}
+	return j
+}
+
+// FailedJournal returns the records of j that weren't inserted by InsertJournal, given the error it returned
+func FailedJournal(j *Journal, err error) *Journal {
+	var ierr *InsertError
+	if errors.As(err, &ierr) {
+		return ierr.Failed()
+	}
+	return j
 }
 
 // NewGraphQLConn returns a new GraphQLConn
@@ -123,13 +221,17 @@ func NewGraphQLConn(endpoint, adminSecret, apiSecret string, opts ...Option) (*G
 }
 
 // ReadSystems reads the Systems from the connection
-func (c *GraphQLConn) ReadSystems() ([]*snmp.System, error) {
+func (c *GraphQLConn) ReadSystems(ctx context.Context) ([]*snmp.System, error) {
 	type response struct {
 		System []*struct {
+			ID       int64 `json:"id"`
 			Hostname struct {
 				Hostname string `json:"hostname"`
 			} `json:"hostname"`
 			Port             uint16                 `json:"port"`
+			PollInterval     time.Duration          `json:"poll_interval"`
+			Failures         int                    `json:"consecutive_failures"`
+			CollectOptics    bool                   `json:"collect_optics"`
 			ConnectionConfig *snmp.ConnectionConfig `json:"connection"`
 		} `json:"system"`
 	}
@@ -139,7 +241,7 @@ func (c *GraphQLConn) ReadSystems() ([]*snmp.System, error) {
 	}
 
 	c.mu.Lock()
-	payload, err := c.conn.Execute(context.Background(), q)
+	payload, err := c.conn.Execute(ctx, q)
 	c.mu.Unlock()
 	if err != nil {
 		return nil, fmt.Errorf("Unable to execute query: %w", err)
@@ -158,8 +260,12 @@ func (c *GraphQLConn) ReadSystems() ([]*snmp.System, error) {
 	systems := make([]*snmp.System, 0, len(resp.System))
 	for _, s := range resp.System {
 		systems = append(systems, &snmp.System{
+			ID:               s.ID,
 			Hostname:         s.Hostname.Hostname,
 			Port:             s.Port,
+			PollInterval:     s.PollInterval,
+			Failures:         s.Failures,
+			CollectOptics:    s.CollectOptics,
 			ConnectionConfig: s.ConnectionConfig,
 		})
 	}
@@ -167,8 +273,48 @@ func (c *GraphQLConn) ReadSystems() ([]*snmp.System, error) {
 	return systems, nil
 }
 
-// InsertJournal submits the Journal
-func (c *GraphQLConn) InsertJournal(j *Journal) (int, error) {
+// InsertJournal submits the Journal. The Journal is split into chunks that are each inserted in a single transaction,
+// and failed chunks are retried. If any chunks still fail, an *InsertError is returned
+func (c *GraphQLConn) InsertJournal(ctx context.Context, j *Journal) (int, error) {
+	chunks := j.Split(c.chunkSize)
+	rows := 0
+	ierr := new(InsertError)
+
+	for idx, chunk := range chunks {
+		debugName := "query.json"
+		if len(chunks) > 1 {
+			debugName = fmt.Sprintf("query-%d.json", idx)
+		}
+
+		var n int
+		var err error
+		for attempt := 0; attempt <= c.retries; attempt++ {
+			if attempt > 0 {
+				log.Printf("WARNING: Retrying chunk %d/%d: %v\n", idx+1, len(chunks), err)
+				select {
+				case <-time.After(time.Duration(attempt) * 5 * time.Second):
+				case <-ctx.Done():
+				}
+			}
+			if n, err = c.insertJournal(ctx, chunk, debugName); err == nil || ctx.Err() != nil {
+				break
+			}
+		}
+		if err != nil {
+			ierr.Chunks = append(ierr.Chunks, &ChunkError{Chunk: idx, Chunks: len(chunks), Journal: chunk, Err: err})
+			continue
+		}
+		rows += n
+	}
+
+	if len(ierr.Chunks) > 0 {
+		return rows, ierr
+	}
+
+	return rows, nil
+}
+
+func (c *GraphQLConn) insertJournal(ctx context.Context, j *Journal, debugName string) (int, error) {
 	type response struct {
 		InsertPortJournal struct {
 			Rows int `json:"affected_rows"`
@@ -185,27 +331,59 @@ func (c *GraphQLConn) InsertJournal(j *Journal) (int, error) {
 		InsertResolveJournal struct {
 			Rows int `json:"affected_rows"`
 		} `json:"insert_resolve_journal"`
+		InsertEntityJournal struct {
+			Rows int `json:"affected_rows"`
+		} `json:"insert_entity_journal"`
+		InsertSensorJournal struct {
+			Rows int `json:"affected_rows"`
+		} `json:"insert_sensor_journal"`
+		InsertPortCounterJournal struct {
+			Rows int `json:"affected_rows"`
+		} `json:"insert_port_counter_journal"`
+		InsertCollectorErrorJournal struct {
+			Rows int `json:"affected_rows"`
+		} `json:"insert_collector_error_journal"`
+		InsertSystemPoll struct {
+			Rows int `json:"affected_rows"`
+		} `json:"insert_system_poll"`
+		InsertSystem struct {
+			Rows int `json:"affected_rows"`
+		} `json:"insert_system"`
+	}
+
+	//without a ChangeTracker every record is a new sample, so a conflict is an error
+	var portConflict, macAddressConflict *Upsert
+	if j.Intervals {
+		portConflict, macAddressConflict = portJournalOnConflict, macAddressJournalOnConflict
 	}
 
 	var q = &graphql.MessagePayloadStart{
 		Query: gqlInsertJournal,
 		Variables: map[string]interface{}{
-			"ports":         j.Ports,
-			"lldps":         j.LLDPs,
-			"mac_addresses": j.MacAddresses,
-			"arps":          j.Arps,
-			"resolves":      j.Resolves,
+			"ports":                j.Ports,
+			"lldps":                j.LLDPs,
+			"mac_addresses":        j.MacAddresses,
+			"arps":                 j.Arps,
+			"resolves":             j.Resolves,
+			"entities":             j.Entities,
+			"sensors":              j.Sensors,
+			"port_counters":        j.PortCounters,
+			"collector_errors":     j.CollectorErrors,
+			"polls":                j.Polls,
+			"systems":              j.Systems,
+			"port_conflict":        portConflict,
+			"mac_address_conflict": macAddressConflict,
 		},
 	}
 
 	if c.debugPath != "" {
-		if err := writeDebug(filepath.Join(c.debugPath, "query.json"), q); err != nil {
+		if err := writeDebug(filepath.Join(c.debugPath, debugName), q); err != nil {
 			log.Println("WARNING: could not write query:", err)
 		}
 	}
 
 	c.mu.Lock()
-	payload, err := c.conn.Execute(context.Background(), q)
+	payload, err := c.conn.Execute(ctx, q)
 	c.mu.Unlock()
 	if err != nil {
 		return 0, fmt.Errorf("Unable to execute query: %w", err)
@@ -225,6 +403,12 @@ func (c *GraphQLConn) InsertJournal(j *Journal) (int, error) {
 			resp.InsertLLDPJournal.Rows +
 			resp.InsertMacAddressJournal.Rows +
 			resp.InsertArpJournal.Rows +
-			resp.InsertResolveJournal.Rows,
+			resp.InsertResolveJournal.Rows +
+			resp.InsertEntityJournal.Rows +
+			resp.InsertSensorJournal.Rows +
+			resp.InsertPortCounterJournal.Rows +
+			resp.InsertCollectorErrorJournal.Rows +
+			resp.InsertSystemPoll.Rows +
+			resp.InsertSystem.Rows,
 		nil
 }
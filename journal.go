@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/korylprince/snmp-tracker/snmp"
@@ -14,15 +15,16 @@ type Upsert struct {
 }
 
 var hostnameOnConflict = &Upsert{Constraint: "unique_hostname", UpdateColumns: []string{"hostname"}}
-var systemOnConflict = &Upsert{Constraint: "unique_system_name", UpdateColumns: []string{"name"}}
-var systemOnConflictHostname = &Upsert{Constraint: "unique_system_name", UpdateColumns: []string{"name", "hostname_id"}}
 var macAddressOnConflict = &Upsert{Constraint: "unique_mac_address", UpdateColumns: []string{"mac_address"}}
 var portOnConflict = &Upsert{Constraint: "unique_port_system_name", UpdateColumns: []string{"system_id", "name"}}
-var portOnConflictMacAddressDescription = &Upsert{Constraint: "unique_port_system_name", UpdateColumns: []string{"system_id", "name", "mac_address_id", "description"}}
-var lldpOnConflict = &Upsert{Constraint: "unique_lldp", UpdateColumns: []string{"local_port_id", "remote_port_id"}}
+var portOnConflictDetails = &Upsert{Constraint: "unique_port_system_name", UpdateColumns: []string{"system_id", "name", "mac_address_id", "name_source", "if_descr", "description", "if_type", "class"}}
+var lldpOnConflict = &Upsert{Constraint: "unique_lldp", UpdateColumns: []string{"local_port_id", "remote_port_id", "protocol"}}
 var ipAddressOnConflict = &Upsert{Constraint: "unique_ip_address", UpdateColumns: []string{"ip_address"}}
 var arpOnConflict = &Upsert{Constraint: "unique_arp", UpdateColumns: []string{"mac_address_id", "ip_address_id"}}
 var resolveOnConflict = &Upsert{Constraint: "unique_resolve", UpdateColumns: []string{"ip_address_id", "hostname_id"}}
+var portJournalOnConflict = &Upsert{Constraint: "unique_port_journal", UpdateColumns: []string{"last_seen"}}
+var macAddressJournalOnConflict = &Upsert{Constraint: "unique_mac_address_journal", UpdateColumns: []string{"last_seen"}}
+var entityOnConflict = &Upsert{Constraint: "unique_entity", UpdateColumns: []string{"contained_in", "class", "position", "name", "description", "port_id"}}
 
 // Hostname is a device hostname
 type Hostname struct {
@@ -35,10 +37,52 @@ type HostnamePointer struct {
 	OnConflict *Upsert   `json:"on_conflict"`
 }
 
-// System is a device
+// System is a device. Systems are upserted by identity, which is set from ChassisID by the database,
+// or matched by Name if ChassisID is empty
 type System struct {
-	Name     string           `json:"name"`
-	Hostname *HostnamePointer `json:"hostname,omitempty"`
+	Name                string           `json:"name"`
+	ChassisID           string           `json:"chassis_id,omitempty"`
+	Hostname            *HostnamePointer `json:"hostname,omitempty"`
+	Platform            string           `json:"platform,omitempty"`
+	ManagementAddress   string           `json:"management_address,omitempty"`
+	NeighborDescription string           `json:"neighbor_description,omitempty"`
+	Capabilities        string           `json:"capabilities,omitempty"` //Postgres array literal
+}
+
+// key identifies the system across Journals
+func (s *System) key() string {
+	if s.ChassisID != "" {
+		return s.ChassisID
+	}
+	return s.Name
+}
+
+// systemUpsert returns an upsert clause for s that only updates the columns set in s. Neighbors that don't advertise
+// a system name are named by their chassis ID, which doesn't replace the name of an existing system
+func systemUpsert(s *System) *Upsert {
+	cols := []string{}
+	if s.ChassisID == "" || s.Name != s.ChassisID {
+		cols = append(cols, "name")
+	}
+	if s.ChassisID != "" {
+		cols = append(cols, "chassis_id")
+	}
+	if s.Hostname != nil {
+		cols = append(cols, "hostname_id")
+	}
+	if s.Platform != "" {
+		cols = append(cols, "platform")
+	}
+	if s.ManagementAddress != "" {
+		cols = append(cols, "management_address")
+	}
+	if s.NeighborDescription != "" {
+		cols = append(cols, "neighbor_description")
+	}
+	if s.Capabilities != "" {
+		cols = append(cols, "capabilities")
+	}
+	return &Upsert{Constraint: "unique_system_identity", UpdateColumns: cols}
 }
 
 // SystemPointer is a pointer to a System
@@ -47,6 +91,13 @@ type SystemPointer struct {
 	OnConflict *Upsert `json:"on_conflict"`
 }
 
+func (sp *SystemPointer) key() string {
+	if sp == nil || sp.Data == nil {
+		return ""
+	}
+	return sp.Data.key()
+}
+
 // MacAddress is a MAC address
 type MacAddress struct {
 	MacAddress string `json:"mac_address"`
@@ -61,9 +112,13 @@ type MacAddressPointer struct {
 // Port is a switch port
 type Port struct {
 	System      *SystemPointer     `json:"system"`
-	MacAddress  *MacAddressPointer `json:"mac_address"`
+	MacAddress  *MacAddressPointer `json:"mac_address,omitempty"`
 	Name        string             `json:"name"`
+	NameSource  string             `json:"name_source,omitempty"`
+	IfDescr     string             `json:"if_descr,omitempty"`
 	Description string             `json:"description"`
+	Type        int                `json:"if_type,omitempty"`
+	Class       string             `json:"class,omitempty"`
 }
 
 // PortPointer is a pointer to a port
@@ -72,18 +127,29 @@ type PortPointer struct {
 	OnConflict *Upsert `json:"on_conflict"`
 }
 
+// systemKey returns the key of the port's system, or an empty string if pp is nil
+func (pp *PortPointer) systemKey() string {
+	if pp == nil || pp.Data == nil {
+		return ""
+	}
+	return pp.Data.System.key()
+}
+
 // PortJournal is a journal of ports
 type PortJournal struct {
-	Port   *PortPointer `json:"port"`
-	Time   *time.Time   `json:"time"`
-	Status string       `json:"status"`
-	Speed  int          `json:"speed"`
+	Port        *PortPointer `json:"port"`
+	Time        *time.Time   `json:"time"`
+	LastSeen    *time.Time   `json:"last_seen"`
+	Status      string       `json:"status"`
+	AdminStatus string       `json:"admin_status,omitempty"`
+	Speed       int          `json:"speed"`
 }
 
-// LLDP is an LLDP record
+// LLDP is a neighbor adjacency learned by a discovery protocol
 type LLDP struct {
 	LocalPort  *PortPointer `json:"local_port"`
 	RemotePort *PortPointer `json:"remote_port"`
+	Protocol   string       `json:"protocol"`
 }
 
 // LLDPPointer is a pointer to an LLDP
@@ -103,6 +169,7 @@ type MacAddressJournal struct {
 	MacAddress *MacAddressPointer `json:"mac_address"`
 	Port       *PortPointer       `json:"port"`
 	Time       *time.Time         `json:"time"`
+	LastSeen   *time.Time         `json:"last_seen"`
 	Vlan       int                `json:"vlan"`
 }
 
@@ -131,8 +198,9 @@ type ArpPointer struct {
 
 // ArpJournal is a journal of ARP records
 type ArpJournal struct {
-	Arp  *ArpPointer `json:"arp"`
-	Time *time.Time  `json:"time"`
+	Arp  *ArpPointer  `json:"arp"`
+	Port *PortPointer `json:"port,omitempty"`
+	Time *time.Time   `json:"time"`
 }
 
 // Resolve is a hostname resolution record
@@ -153,43 +221,392 @@ type ResolveJournal struct {
 	Time    *time.Time      `json:"time"`
 }
 
+// CollectorErrorJournal is a journal of failed collectors
+type CollectorErrorJournal struct {
+	System    *SystemPointer `json:"system"`
+	Time      *time.Time     `json:"time"`
+	Collector string         `json:"collector"`
+	Error     string         `json:"error"`
+}
+
+// Entity is a physical component of a system
+type Entity struct {
+	System      *SystemPointer `json:"system"`
+	Index       int            `json:"index"`
+	ContainedIn int            `json:"contained_in"`
+	Class       string         `json:"class"`
+	Position    int            `json:"position"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Port        *PortPointer   `json:"port,omitempty"`
+}
+
+// EntityPointer is a pointer to an Entity
+type EntityPointer struct {
+	Data       *Entity `json:"data"`
+	OnConflict *Upsert `json:"on_conflict"`
+}
+
+// EntityJournal is a journal of the hardware and software of entities. Time is when the combination was first seen
+type EntityJournal struct {
+	Entity       *EntityPointer `json:"entity"`
+	Time         *time.Time     `json:"time"`
+	LastSeen     *time.Time     `json:"last_seen"`
+	HardwareRev  string         `json:"hardware_rev"`
+	FirmwareRev  string         `json:"firmware_rev"`
+	SoftwareRev  string         `json:"software_rev"`
+	Serial       string         `json:"serial"`
+	Manufacturer string         `json:"manufacturer"`
+	Model        string         `json:"model"`
+}
+
+// PortCounterJournal is a journal of port traffic counters. Rates are per second since the previous sample of the
+// port, and are nil if there isn't one or the counters were reset. They're set by CounterTracker
+type PortCounterJournal struct {
+	Port                 *PortPointer `json:"port"`
+	Time                 *time.Time   `json:"time"`
+	InOctets             uint64       `json:"in_octets"`
+	OutOctets            uint64       `json:"out_octets"`
+	InUnicastPackets     uint64       `json:"in_unicast_packets"`
+	OutUnicastPackets    uint64       `json:"out_unicast_packets"`
+	InMulticastPackets   *uint64      `json:"in_multicast_packets,omitempty"`
+	OutMulticastPackets  *uint64      `json:"out_multicast_packets,omitempty"`
+	InBroadcastPackets   *uint64      `json:"in_broadcast_packets,omitempty"`
+	OutBroadcastPackets  *uint64      `json:"out_broadcast_packets,omitempty"`
+	InErrors             uint64       `json:"in_errors"`
+	OutErrors            uint64       `json:"out_errors"`
+	InDiscards           uint64       `json:"in_discards"`
+	OutDiscards          uint64       `json:"out_discards"`
+	Interval             *float64     `json:"interval"`
+	InBitsPerSecond      *float64     `json:"in_bps"`
+	OutBitsPerSecond     *float64     `json:"out_bps"`
+	InPacketsPerSecond   *float64     `json:"in_pps"`
+	OutPacketsPerSecond  *float64     `json:"out_pps"`
+	InErrorsPerSecond    *float64     `json:"in_errors_per_second"`
+	OutErrorsPerSecond   *float64     `json:"out_errors_per_second"`
+	InDiscardsPerSecond  *float64     `json:"in_discards_per_second"`
+	OutDiscardsPerSecond *float64     `json:"out_discards_per_second"`
+	InUtilization        *float64     `json:"in_utilization"`
+	OutUtilization       *float64     `json:"out_utilization"`
+
+	//used by CounterTracker to compute rates
+	ifIndex       int
+	bits          int
+	inNonUnicast  *uint64
+	outNonUnicast *uint64
+	uptime        time.Duration
+	speed         uint
+}
+
+// SensorJournal is a journal of transceiver sensor readings
+type SensorJournal struct {
+	Port        *PortPointer `json:"port"`
+	Time        *time.Time   `json:"time"`
+	Name        string       `json:"name"`
+	Type        string       `json:"type"`
+	Value       float64      `json:"value"`
+	Status      string       `json:"status"`
+	LowAlarm    *float64     `json:"low_alarm"`
+	LowWarning  *float64     `json:"low_warning"`
+	HighWarning *float64     `json:"high_warning"`
+	HighAlarm   *float64     `json:"high_alarm"`
+}
+
+// SystemPoll is the result of polling a system. The system group fields are empty if the system couldn't be read
+type SystemPoll struct {
+	SystemID        int64      `json:"system_id"`
+	StartTime       *time.Time `json:"start_time"`
+	EndTime         *time.Time `json:"end_time"`
+	Success         bool       `json:"success"`
+	Error           string     `json:"error"`
+	Ports           int        `json:"ports"`
+	LLDPs           int        `json:"lldps"`
+	MacAddresses    int        `json:"mac_addresses"`
+	Arps            int        `json:"arps"`
+	Resolves        int        `json:"resolves"`
+	Entities        int        `json:"entities"`
+	Sensors         int        `json:"sensors"`
+	PortCounters    int        `json:"port_counters"`
+	CollectorErrors int        `json:"collector_errors"`
+	Description     string     `json:"description,omitempty"`
+	ObjectID        string     `json:"object_id,omitempty"`
+	UpTime          *int64     `json:"uptime,omitempty"`
+	Location        string     `json:"location,omitempty"`
+	Contact         string     `json:"contact,omitempty"`
+
+	//system is the key of the polled system, used by Split. It's empty if the system couldn't be read
+	system string
+}
+
 // Journal is a journal of records
 type Journal struct {
-	Ports        []*PortJournal
-	LLDPs        []*LLDPJournal
-	MacAddresses []*MacAddressJournal
-	Arps         []*ArpJournal
-	Resolves     []*ResolveJournal
+	Ports           []*PortJournal
+	LLDPs           []*LLDPJournal
+	MacAddresses    []*MacAddressJournal
+	Arps            []*ArpJournal
+	Resolves        []*ResolveJournal
+	Entities        []*EntityJournal
+	Sensors         []*SensorJournal
+	PortCounters    []*PortCounterJournal
+	CollectorErrors []*CollectorErrorJournal
+	Polls           []*SystemPoll
+	Systems         []*System
+
+	//Intervals is set if the port and MAC address journals were rewritten by a ChangeTracker,
+	//so unchanged records are upserted to update last_seen
+	Intervals bool
+}
+
+// NewJournal returns a new Journal with empty records
+func NewJournal() *Journal {
+	return &Journal{
+		Ports:           make([]*PortJournal, 0),
+		LLDPs:           make([]*LLDPJournal, 0),
+		MacAddresses:    make([]*MacAddressJournal, 0),
+		Arps:            make([]*ArpJournal, 0),
+		Resolves:        make([]*ResolveJournal, 0),
+		Entities:        make([]*EntityJournal, 0),
+		Sensors:         make([]*SensorJournal, 0),
+		PortCounters:    make([]*PortCounterJournal, 0),
+		CollectorErrors: make([]*CollectorErrorJournal, 0),
+		Polls:           make([]*SystemPoll, 0),
+		Systems:         make([]*System, 0),
+	}
+}
+
+// Len returns the number of records in the Journal
+func (j *Journal) Len() int {
+	return len(j.Ports) + len(j.LLDPs) + len(j.MacAddresses) + len(j.Arps) + len(j.Resolves) + len(j.Entities) + len(j.Sensors) + len(j.PortCounters) + len(j.CollectorErrors) + len(j.Polls) + len(j.Systems)
+}
+
+// Merge appends the records of other to j
+func (j *Journal) Merge(other *Journal) {
+	j.Ports = append(j.Ports, other.Ports...)
+	j.LLDPs = append(j.LLDPs, other.LLDPs...)
+	j.MacAddresses = append(j.MacAddresses, other.MacAddresses...)
+	j.Arps = append(j.Arps, other.Arps...)
+	j.Resolves = append(j.Resolves, other.Resolves...)
+	j.Entities = append(j.Entities, other.Entities...)
+	j.Sensors = append(j.Sensors, other.Sensors...)
+	j.PortCounters = append(j.PortCounters, other.PortCounters...)
+	j.CollectorErrors = append(j.CollectorErrors, other.CollectorErrors...)
+	j.Polls = append(j.Polls, other.Polls...)
+	j.Systems = append(j.Systems, other.Systems...)
+	j.Intervals = j.Intervals || other.Intervals
+}
+
+// Split splits the Journal into Journals with at most n records each. If n <= 0, the Journal isn't split.
+// Each system's records are kept in the same Journal so a failed chunk never partially inserts a system,
+// so a system with more than n records is split into a Journal of its own
+func (j *Journal) Split(n int) []*Journal {
+	if n <= 0 || j.Len() <= n {
+		return []*Journal{j}
+	}
+
+	//records that don't belong to a system can be inserted in any chunk, so they're grouped individually
+	var groups []*Journal
+	keyed := make(map[string]*Journal)
+	group := func(key string) *Journal {
+		if g, ok := keyed[key]; ok {
+			return g
+		}
+		g := NewJournal()
+		groups = append(groups, g)
+		if key != "" {
+			keyed[key] = g
+		}
+		return g
+	}
+
+	for _, r := range j.Ports {
+		g := group(r.Port.systemKey())
+		g.Ports = append(g.Ports, r)
+	}
+	for _, r := range j.LLDPs {
+		g := group(r.LLDP.Data.LocalPort.systemKey())
+		g.LLDPs = append(g.LLDPs, r)
+	}
+	for _, r := range j.MacAddresses {
+		g := group(r.Port.systemKey())
+		g.MacAddresses = append(g.MacAddresses, r)
+	}
+	for _, r := range j.Arps {
+		g := group(r.Port.systemKey())
+		g.Arps = append(g.Arps, r)
+	}
+	for _, r := range j.Resolves {
+		g := group("")
+		g.Resolves = append(g.Resolves, r)
+	}
+	for _, r := range j.Entities {
+		g := group(r.Entity.Data.System.key())
+		g.Entities = append(g.Entities, r)
+	}
+	for _, r := range j.Sensors {
+		g := group(r.Port.systemKey())
+		g.Sensors = append(g.Sensors, r)
+	}
+	for _, r := range j.PortCounters {
+		g := group(r.Port.systemKey())
+		g.PortCounters = append(g.PortCounters, r)
+	}
+	for _, r := range j.CollectorErrors {
+		g := group(r.System.key())
+		g.CollectorErrors = append(g.CollectorErrors, r)
+	}
+	for _, r := range j.Polls {
+		g := group(r.system)
+		g.Polls = append(g.Polls, r)
+	}
+	for _, r := range j.Systems {
+		g := group(r.key())
+		g.Systems = append(g.Systems, r)
+	}
+
+	chunks := []*Journal{NewJournal()}
+	for _, g := range groups {
+		c := chunks[len(chunks)-1]
+		if c.Len() > 0 && c.Len()+g.Len() > n {
+			c = NewJournal()
+			chunks = append(chunks, c)
+		}
+		c.Merge(g)
+	}
+	for _, c := range chunks {
+		c.Intervals = j.Intervals
+	}
+
+	return chunks
+}
+
+// systemKey identifies the system of the port in a single Journal
+func systemKey(p *snmp.Port) string {
+	if p.ChassisID != "" {
+		return p.ChassisID
+	}
+	return p.SystemName
 }
 
 func portKey(p *snmp.Port) string {
-	return fmt.Sprintf("%s:%s", p.SystemName, p.Name)
+	return fmt.Sprintf("%s:%s", systemKey(p), p.Name)
 }
 
-// Translate translates SNMP info to a Journal
-func Translate(i *snmp.NetInfo) *Journal {
-	j := new(Journal)
+func translatePoll(p *Poll) *SystemPoll {
+	start, end := p.Start.UTC(), p.End.UTC()
+	sp := &SystemPoll{SystemID: p.System.ID, StartTime: &start, EndTime: &end}
+	if p.Err != nil {
+		sp.Error = p.Err.Error()
+		return sp
+	}
+
+	if i := p.Info.System; i != nil {
+		sp.system = systemKey(&snmp.Port{SystemName: i.Name, ChassisID: i.ChassisID})
+		uptime := int64(i.UpTime.Seconds())
+		sp.Description, sp.ObjectID, sp.UpTime, sp.Location, sp.Contact = i.Description, i.ObjectID, &uptime, i.Location, i.Contact
+	}
+
+	sp.Ports = len(p.Info.Ports)
+	sp.LLDPs = len(p.Info.LLDPs)
+	sp.MacAddresses = len(p.Info.MacAddresses)
+	sp.Arps = len(p.Info.Arps)
+	sp.Resolves = len(p.Info.Resolves)
+	sp.Entities = len(p.Info.Entities)
+	sp.Sensors = len(p.Info.Sensors)
+	for _, port := range p.Info.Ports {
+		if port.Counters != nil {
+			sp.PortCounters++
+		}
+	}
+	sp.CollectorErrors = len(p.Info.Errors)
+
+	errs := make([]string, 0, len(p.Info.Errors))
+	for _, e := range p.Info.Errors {
+		errs = append(errs, e.Error())
+	}
+	sp.Error = strings.Join(errs, "; ")
+	//the system was read; collector errors are reported by CollectorErrors and Error
+	sp.Success = true
+
+	return sp
+}
+
+// Translate translates SNMP info and the polls that produced it to a Journal.
+// known maps port MAC addresses of systems polled previously to a port on that system,
+// so ARP records can be matched to systems that aren't in i
+func Translate(i *snmp.NetInfo, polls []*Poll, known map[string]*snmp.Port) *Journal {
+	j := NewJournal()
 	t := time.Now().UTC()
 
+	//sysCache is keyed by systemKey, and macCache by port MAC address
 	sysCache := make(map[string]*SystemPointer)
+	macCache := make(map[string]*SystemPointer)
 	portCache := make(map[string]*PortPointer)
 
+	system := func(p *snmp.Port) *SystemPointer {
+		if sp, ok := sysCache[systemKey(p)]; ok {
+			return sp
+		}
+		s := &System{Name: p.SystemName, ChassisID: p.ChassisID}
+		sp := &SystemPointer{Data: s, OnConflict: systemUpsert(s)}
+		sysCache[systemKey(p)] = sp
+		return sp
+	}
+
 	for _, p := range i.Ports {
-		var sp *SystemPointer
-		if s, ok := sysCache[p.MacAddress]; ok {
-			sp = s
-		} else {
-			sp = &SystemPointer{Data: &System{Name: p.SystemName}, OnConflict: systemOnConflict}
-			sysCache[p.MacAddress] = sp
+		//ports with duplicate names resolve to the same row, so only the first is journaled
+		if _, ok := portCache[portKey(p)]; ok {
+			continue
 		}
+		sp := system(p)
+		macCache[p.MacAddress] = sp
 		mp := &MacAddressPointer{Data: &MacAddress{MacAddress: p.MacAddress}, OnConflict: macAddressOnConflict}
 		pp := &PortPointer{
-			Data:       &Port{System: sp, MacAddress: mp, Name: p.Name, Description: p.Description},
-			OnConflict: portOnConflictMacAddressDescription,
+			Data: &Port{
+				System:      sp,
+				MacAddress:  mp,
+				Name:        p.Name,
+				NameSource:  p.NameSource,
+				IfDescr:     p.IfDescr,
+				Description: p.Description,
+				Type:        p.Type,
+				Class:       p.Class(),
+			},
+			OnConflict: portOnConflictDetails,
 		}
 		portCache[portKey(p)] = pp
-		pj := &PortJournal{Port: pp, Time: &t, Status: p.LinkStatus.String(), Speed: int(p.Speed)}
+		pj := &PortJournal{Port: pp, Time: &t, LastSeen: &t, Status: p.LinkStatus.String(), Speed: int(p.Speed)}
+		if p.AdminStatus != 0 {
+			pj.AdminStatus = p.AdminStatus.String()
+		}
 		j.Ports = append(j.Ports, pj)
+
+		if c := p.Counters; c != nil {
+			pc := &PortCounterJournal{
+				Port:                pp,
+				Time:                &t,
+				InOctets:            c.InOctets,
+				OutOctets:           c.OutOctets,
+				InUnicastPackets:    c.InUnicast,
+				OutUnicastPackets:   c.OutUnicast,
+				InMulticastPackets:  c.InMulticast,
+				OutMulticastPackets: c.OutMulticast,
+				InBroadcastPackets:  c.InBroadcast,
+				OutBroadcastPackets: c.OutBroadcast,
+				InErrors:            c.InErrors,
+				OutErrors:           c.OutErrors,
+				InDiscards:          c.InDiscards,
+				OutDiscards:         c.OutDiscards,
+				ifIndex:             p.IfIndex,
+				bits:                c.Bits,
+				inNonUnicast:        c.InNonUnicast,
+				outNonUnicast:       c.OutNonUnicast,
+				speed:               p.Speed,
+			}
+			if i.System != nil {
+				pc.uptime = i.System.UpTime
+			}
+			j.PortCounters = append(j.PortCounters, pc)
+		}
 	}
 
 	for _, l := range i.LLDPs {
@@ -197,41 +614,76 @@ func Translate(i *snmp.NetInfo) *Journal {
 		if p, ok := portCache[portKey(l.RemotePort)]; ok {
 			pp = p
 		} else {
-			var sp *SystemPointer
-			if s, ok := sysCache[l.RemotePort.MacAddress]; ok {
-				sp = s
-			} else {
-				sp = &SystemPointer{Data: &System{Name: l.RemotePort.SystemName}, OnConflict: systemOnConflict}
-				sysCache[l.RemotePort.MacAddress] = sp
+			sp := system(l.RemotePort)
+			var mp *MacAddressPointer
+			if l.RemotePort.MacAddress != "" {
+				macCache[l.RemotePort.MacAddress] = sp
+				mp = &MacAddressPointer{Data: &MacAddress{MacAddress: l.RemotePort.MacAddress}, OnConflict: macAddressOnConflict}
 			}
-			mp := &MacAddressPointer{Data: &MacAddress{MacAddress: l.RemotePort.MacAddress}, OnConflict: macAddressOnConflict}
 			pp = &PortPointer{
-				Data:       &Port{System: sp, MacAddress: mp, Name: l.RemotePort.Name},
+				Data:       &Port{System: sp, MacAddress: mp, Name: l.RemotePort.Name, NameSource: l.Protocol},
 				OnConflict: portOnConflict,
 			}
 			portCache[portKey(l.RemotePort)] = pp
 		}
-		lp := &LLDPPointer{Data: &LLDP{LocalPort: portCache[portKey(l.LocalPort)], RemotePort: pp}, OnConflict: lldpOnConflict}
+		if sp := pp.Data.System; l.RemotePlatform != "" || l.RemoteAddress != "" || l.RemoteDescription != "" || l.RemoteCapabilities != nil {
+			if l.RemotePlatform != "" {
+				sp.Data.Platform = l.RemotePlatform
+			}
+			if l.RemoteAddress != "" {
+				sp.Data.ManagementAddress = l.RemoteAddress
+			}
+			if l.RemoteDescription != "" {
+				sp.Data.NeighborDescription = l.RemoteDescription
+			}
+			if l.RemoteCapabilities != nil {
+				sp.Data.Capabilities = "{" + strings.Join(l.RemoteCapabilities, ",") + "}"
+			}
+			sp.OnConflict = systemUpsert(sp.Data)
+		}
+		lp := &LLDPPointer{
+			Data:       &LLDP{LocalPort: portCache[portKey(l.LocalPort)], RemotePort: pp, Protocol: l.Protocol},
+			OnConflict: lldpOnConflict,
+		}
 		lj := &LLDPJournal{LLDP: lp, Time: &t}
 		j.LLDPs = append(j.LLDPs, lj)
 	}
 
+	macSeen := make(map[string]bool)
 	for _, m := range i.MacAddresses {
+		//MAC addresses on ports with duplicate names resolve to the same row
+		key := fmt.Sprintf("%s/%s/%d", m.MacAddress, portKey(m.Port), m.Vlan)
+		if macSeen[key] {
+			continue
+		}
+		macSeen[key] = true
 		mp := &MacAddressPointer{Data: &MacAddress{MacAddress: m.MacAddress}, OnConflict: macAddressOnConflict}
-		mj := &MacAddressJournal{MacAddress: mp, Port: portCache[portKey(m.Port)], Time: &t, Vlan: m.Vlan}
+		mj := &MacAddressJournal{MacAddress: mp, Port: portCache[portKey(m.Port)], Time: &t, LastSeen: &t, Vlan: m.Vlan}
 		j.MacAddresses = append(j.MacAddresses, mj)
 	}
 
 	arpCache := make(map[string]*SystemPointer)
+	var knownSystems []*SystemPointer
 
 	for _, a := range i.Arps {
 		mp := &MacAddressPointer{Data: &MacAddress{MacAddress: a.MacAddress}, OnConflict: macAddressOnConflict}
 		ip := &IPAddressPointer{Data: &IPAddress{IPAddress: a.IPAddress}, OnConflict: ipAddressOnConflict}
 		ap := &ArpPointer{Data: &Arp{MacAddress: mp, IPAddress: ip}, OnConflict: arpOnConflict}
 		aj := &ArpJournal{Arp: ap, Time: &t}
+		if a.Port != nil {
+			aj.Port = portCache[portKey(a.Port)]
+		}
 		j.Arps = append(j.Arps, aj)
-		if s, ok := sysCache[a.MacAddress]; ok {
+		if s, ok := macCache[a.MacAddress]; ok {
 			arpCache[a.IPAddress] = s
+		} else if p, ok := known[a.MacAddress]; ok {
+			_, cached := sysCache[systemKey(p)]
+			sp := system(p)
+			macCache[a.MacAddress] = sp
+			arpCache[a.IPAddress] = sp
+			if !cached {
+				knownSystems = append(knownSystems, sp)
+			}
 		}
 	}
 
@@ -240,12 +692,79 @@ func Translate(i *snmp.NetInfo) *Journal {
 		hp := &HostnamePointer{Data: &Hostname{Hostname: r.Hostname}, OnConflict: hostnameOnConflict}
 		if s, ok := arpCache[r.IPAddress]; ok {
 			s.Data.Hostname = hp
-			s.OnConflict = systemOnConflictHostname
+			s.OnConflict = systemUpsert(s.Data)
 		}
 		rp := &ResolvePointer{Data: &Resolve{IPAddress: ip, Hostname: hp}, OnConflict: resolveOnConflict}
 		rj := &ResolveJournal{Resolve: rp, Time: &t}
 		j.Resolves = append(j.Resolves, rj)
 	}
 
+	//systems that aren't referenced by a port need to be inserted directly to update their hostname
+	for _, sp := range knownSystems {
+		if sp.Data.Hostname != nil {
+			j.Systems = append(j.Systems, sp.Data)
+		}
+	}
+
+	if len(i.Entities) > 0 {
+		sp := system(&snmp.Port{SystemName: i.System.Name, ChassisID: i.System.ChassisID})
+		for _, e := range i.Entities {
+			ent := &Entity{
+				System:      sp,
+				Index:       e.Index,
+				ContainedIn: e.ContainedIn,
+				Class:       e.Class,
+				Position:    e.Position,
+				Name:        e.Name,
+				Description: e.Description,
+			}
+			if e.Port != nil {
+				ent.Port = portCache[portKey(e.Port)]
+			}
+			ej := &EntityJournal{
+				Entity:       &EntityPointer{Data: ent, OnConflict: entityOnConflict},
+				Time:         &t,
+				LastSeen:     &t,
+				HardwareRev:  e.HardwareRev,
+				FirmwareRev:  e.FirmwareRev,
+				SoftwareRev:  e.SoftwareRev,
+				Serial:       e.Serial,
+				Manufacturer: e.Manufacturer,
+				Model:        e.Model,
+			}
+			j.Entities = append(j.Entities, ej)
+		}
+	}
+
+	for _, s := range i.Sensors {
+		pp, ok := portCache[portKey(s.Port)]
+		if !ok {
+			continue
+		}
+		sj := &SensorJournal{
+			Port:        pp,
+			Time:        &t,
+			Name:        s.Name,
+			Type:        s.Type,
+			Value:       s.Value,
+			Status:      s.Status(),
+			LowAlarm:    s.LowAlarm,
+			LowWarning:  s.LowWarning,
+			HighWarning: s.HighWarning,
+			HighAlarm:   s.HighAlarm,
+		}
+		j.Sensors = append(j.Sensors, sj)
+	}
+
+	for _, e := range i.Errors {
+		sp := system(&snmp.Port{SystemName: e.SystemName, ChassisID: e.ChassisID})
+		ej := &CollectorErrorJournal{System: sp, Time: &t, Collector: e.Collector, Error: e.Err.Error()}
+		j.CollectorErrors = append(j.CollectorErrors, ej)
+	}
+
+	for _, p := range polls {
+		j.Polls = append(j.Polls, translatePoll(p))
+	}
+
 	return j
 }
@@ -1,7 +1,12 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/kelseyhightower/envconfig"
@@ -22,34 +27,78 @@ func main() {
 		opts = append(opts, WithDebugPath(config.DebugPath))
 	}
 
+	opts = append(opts, WithChunkSize(config.InsertChunkSize), WithRetries(config.InsertRetries))
+
+	metrics := NewMetrics()
+	if config.MetricsAddr != "" {
+		log.Println("Serving metrics on", config.MetricsAddr)
+		go func() {
+			log.Fatalln("ERROR: Unable to serve metrics:", http.ListenAndServe(config.MetricsAddr, metrics.Handler()))
+		}()
+	}
+
+	var spool *Spool
+	if config.SpoolPath != "" {
+		var err error
+		if spool, err = NewSpool(config.SpoolPath, config.SpoolMaxSize, config.SpoolMaxAge); err != nil {
+			log.Fatalln("ERROR: Unable to create spool:", err)
+		}
+	}
+
+	var changes *ChangeTracker
+	if config.ChangeOnly {
+		var err error
+		if changes, err = NewChangeTracker(config.ChangeStatePath); err != nil {
+			log.Fatalln("ERROR: Unable to create change tracker:", err)
+		}
+	}
+
 	log.Println("Connecting to", config.GraphQLEndpoint)
 	conn, err := NewGraphQLConn(config.GraphQLEndpoint, config.GraphQLAdminSecret, config.GraphQLAPISecret, opts...)
 	if err != nil {
 		log.Fatalln("ERROR: Unable to connect to GraphQL endpoint:", err)
 	}
 
-	for {
-		systems, err := conn.ReadSystems()
-		if err != nil {
-			log.Println("WARNING: Unable to read systems:", err)
-			time.Sleep(config.PollInterval)
-			continue
-		}
+	poller := NewPoller(config, resolver, conn, spool, metrics, changes)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-		log.Printf("INFO: Getting information from %d systems\n", len(systems))
+	scheduler := NewScheduler(poller, config.PollInterval, config.PollBackoffMax, config.SNMPWorkers)
+	go scheduler.Run(ctx)
 
-		info := GetInfo(resolver, systems, config.SNMPWorkers, config.DebugPath)
+	var traps *TrapReceiver
+	if config.TrapAddr != "" {
+		traps = NewTrapReceiver(scheduler, config.TrapCommunity, config.TrapPollDelay)
+		log.Println("Listening for traps on", config.TrapAddr)
+		go func() {
+			log.Fatalln("ERROR: Unable to listen for traps:", traps.Listen(config.TrapAddr))
+		}()
+	}
 
-		j := Translate(info)
+	refresh := time.NewTicker(config.SystemRefreshInterval)
+	defer refresh.Stop()
 
-		log.Println("INFO: Inserting information into database")
-		rows, err := conn.InsertJournal(j)
-		if err != nil {
-			log.Println("WARNING: Unable to insert information:", err)
-		} else {
-			log.Println("INFO:", rows, "rows inserted")
+	for {
+		systems, err := conn.ReadSystems(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Println("WARNING: Unable to read systems:", err)
+		} else if err == nil {
+			log.Printf("INFO: Scheduling %d systems\n", len(systems))
+			scheduler.SetSystems(systems)
+			if traps != nil {
+				traps.SetSystems(systems)
+			}
 		}
 
-		time.Sleep(config.PollInterval)
+		select {
+		case <-ctx.Done():
+			stop()
+			log.Println("INFO: Shutting down, waiting for in-flight polls")
+			poller.Shutdown(config.ShutdownTimeout)
+			log.Println("INFO: Shutdown complete")
+			return
+		case <-refresh.C:
+		}
 	}
 }
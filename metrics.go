@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/korylprince/snmp-tracker/snmp"
+)
+
+const (
+	metricTypeCounter = "counter"
+	metricTypeGauge   = "gauge"
+)
+
+type metric struct {
+	typ    string
+	help   string
+	values map[string]float64
+}
+
+var metricDefinitions = map[string]*metric{
+	"snmp_tracker_polls_total":                            {typ: metricTypeCounter, help: "Number of system polls by result"},
+	"snmp_tracker_poll_duration_seconds":                  {typ: metricTypeGauge, help: "Duration of the last poll of a system"},
+	"snmp_tracker_poll_last_success_timestamp_seconds":    {typ: metricTypeGauge, help: "Time of the last successful poll of a system"},
+	"snmp_tracker_poll_records":                           {typ: metricTypeGauge, help: "Number of records read in the last poll of a system"},
+	"snmp_tracker_collector_duration_seconds":             {typ: metricTypeGauge, help: "Duration of a collector in the last poll of a system"},
+	"snmp_tracker_collector_pdus_total":                   {typ: metricTypeCounter, help: "Number of SNMP PDUs received by a collector"},
+	"snmp_tracker_collector_errors_total":                 {typ: metricTypeCounter, help: "Number of collector errors"},
+	"snmp_tracker_systems":                                {typ: metricTypeGauge, help: "Number of scheduled systems"},
+	"snmp_tracker_journal_inserts_total":                  {typ: metricTypeCounter, help: "Number of journal inserts by result"},
+	"snmp_tracker_journal_rows_total":                     {typ: metricTypeCounter, help: "Number of journal rows inserted"},
+	"snmp_tracker_journal_insert_duration_seconds":        {typ: metricTypeGauge, help: "Duration of the last journal insert"},
+	"snmp_tracker_journal_last_success_timestamp_seconds": {typ: metricTypeGauge, help: "Time of the last successful journal insert"},
+	"snmp_tracker_journal_last_insert_success":            {typ: metricTypeGauge, help: "Whether the last journal insert succeeded"},
+	"snmp_tracker_resolve_duration_seconds":               {typ: metricTypeGauge, help: "Duration of hostname resolution in the last poll of a system"},
+}
+
+// labels formats the given key, value pairs as Prometheus labels
+func labels(kv ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(kv); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(kv[i+1])
+		fmt.Fprintf(&b, `%s="%s"`, kv[i], v)
+	}
+	return b.String()
+}
+
+// Metrics collects poller metrics and serves them in the Prometheus text format
+type Metrics struct {
+	mu            *sync.Mutex
+	metrics       map[string]*metric
+	lastInsert    time.Time
+	lastInsertErr error
+}
+
+// NewMetrics returns a new Metrics
+func NewMetrics() *Metrics {
+	m := &Metrics{mu: new(sync.Mutex), metrics: make(map[string]*metric)}
+	for name, def := range metricDefinitions {
+		m.metrics[name] = &metric{typ: def.typ, help: def.help, values: make(map[string]float64)}
+	}
+	return m
+}
+
+// must be called with m.mu held
+func (m *Metrics) set(name, l string, v float64) {
+	m.metrics[name].values[l] = v
+}
+
+// must be called with m.mu held
+func (m *Metrics) add(name, l string, v float64) {
+	m.metrics[name].values[l] += v
+}
+
+// RecordPoll records the result of polling a system
+func (m *Metrics) RecordPoll(p *Poll) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	system := p.System.Hostname
+	m.set("snmp_tracker_poll_duration_seconds", labels("system", system), p.End.Sub(p.Start).Seconds())
+
+	if p.Err != nil {
+		m.add("snmp_tracker_polls_total", labels("system", system, "result", "failure"), 1)
+		return
+	}
+
+	//a poll succeeds if the system was read, matching SystemPoll.Success; collector errors are counted per collector below
+	m.set("snmp_tracker_poll_last_success_timestamp_seconds", labels("system", system), float64(p.End.Unix()))
+
+	result := "success"
+	if len(p.Info.Errors) > 0 {
+		result = "partial"
+	}
+	m.add("snmp_tracker_polls_total", labels("system", system, "result", result), 1)
+
+	counters := 0
+	for _, port := range p.Info.Ports {
+		if port.Counters != nil {
+			counters++
+		}
+	}
+
+	for typ, n := range map[string]int{
+		"port":        len(p.Info.Ports),
+		"lldp":        len(p.Info.LLDPs),
+		"mac_address": len(p.Info.MacAddresses),
+		"arp":         len(p.Info.Arps),
+		"resolve":     len(p.Info.Resolves),
+		"entity":      len(p.Info.Entities),
+		"sensor":      len(p.Info.Sensors),
+		"counter":     counters,
+	} {
+		m.set("snmp_tracker_poll_records", labels("system", system, "type", typ), float64(n))
+	}
+
+	for _, s := range p.Info.Stats {
+		if s.Collector == snmp.CollectorResolve {
+			m.set("snmp_tracker_resolve_duration_seconds", labels("system", system), s.Duration.Seconds())
+			continue
+		}
+		l := labels("system", system, "collector", s.Collector)
+		m.set("snmp_tracker_collector_duration_seconds", l, s.Duration.Seconds())
+		m.add("snmp_tracker_collector_pdus_total", l, float64(s.PDUs))
+	}
+
+	for _, e := range p.Info.Errors {
+		m.add("snmp_tracker_collector_errors_total", labels("system", system, "collector", e.Collector), 1)
+	}
+}
+
+// RecordSystems records the number of scheduled systems
+func (m *Metrics) RecordSystems(systems int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set("snmp_tracker_systems", "", float64(systems))
+}
+
+// RecordInsert records the result of InsertJournal
+func (m *Metrics) RecordInsert(rows int, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastInsert = time.Now()
+	m.lastInsertErr = err
+	m.set("snmp_tracker_journal_insert_duration_seconds", "", d.Seconds())
+
+	if err != nil {
+		m.add("snmp_tracker_journal_inserts_total", labels("result", "failure"), 1)
+		m.set("snmp_tracker_journal_last_insert_success", "", 0)
+		return
+	}
+
+	m.add("snmp_tracker_journal_inserts_total", labels("result", "success"), 1)
+	m.add("snmp_tracker_journal_rows_total", "", float64(rows))
+	m.set("snmp_tracker_journal_last_insert_success", "", 1)
+	m.set("snmp_tracker_journal_last_success_timestamp_seconds", "", float64(m.lastInsert.Unix()))
+}
+
+func (m *Metrics) serveMetrics(w http.ResponseWriter, _ *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.metrics))
+	for name := range m.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, name := range names {
+		mt := m.metrics[name]
+		if len(mt.values) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, mt.help, name, mt.typ)
+		ls := make([]string, 0, len(mt.values))
+		for l := range mt.values {
+			ls = append(ls, l)
+		}
+		sort.Strings(ls)
+		for _, l := range ls {
+			if l == "" {
+				fmt.Fprintf(w, "%s %v\n", name, mt.values[l])
+				continue
+			}
+			fmt.Fprintf(w, "%s{%s} %v\n", name, l, mt.values[l])
+		}
+	}
+}
+
+// serveHealth reports whether the last InsertJournal succeeded
+func (m *Metrics) serveHealth(w http.ResponseWriter, _ *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch {
+	case m.lastInsert.IsZero():
+		w.Write([]byte("OK: no journal inserted yet\n"))
+	case m.lastInsertErr != nil:
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "ERROR: last journal insert at %s failed: %v\n", m.lastInsert.Format(time.RFC3339), m.lastInsertErr)
+	default:
+		fmt.Fprintf(w, "OK: last journal insert at %s succeeded\n", m.lastInsert.Format(time.RFC3339))
+	}
+}
+
+// Handler returns an http.Handler serving /metrics and /healthz
+func (m *Metrics) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", m.serveMetrics)
+	mux.HandleFunc("/healthz", m.serveHealth)
+	return mux
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/korylprince/ipscan/resolve"
+	"github.com/korylprince/snmp-tracker/snmp"
+)
+
+// Poll is the result of reading a single system. Info is nil if Err is not nil
+type Poll struct {
+	System *snmp.System
+	Start  time.Time
+	End    time.Time
+	Info   *snmp.NetInfo
+	Err    error
+}
+
+// Poller polls systems and inserts the results into the database
+type Poller struct {
+	config   *Config
+	resolver *resolve.Service
+	conn     *GraphQLConn
+	spool    *Spool
+	metrics  *Metrics
+	changes  *ChangeTracker
+	counters *CounterTracker
+	// changesSaved is when the change state was last saved
+	changesSaved time.Time
+
+	// insertMu serializes inserts, since the spool and change and counter trackers aren't safe for concurrent use
+	insertMu *sync.Mutex
+	// macSystems maps the port MAC addresses of previously polled systems to a port on the system
+	macSystems map[string]*snmp.Port
+
+	// ctx is canceled to abandon in-flight polls and inserts
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       *sync.Mutex
+	inFlight map[int64]bool
+	closed   bool
+	wg       *sync.WaitGroup
+}
+
+// NewPoller returns a new Poller. spool and changes may be nil
+func NewPoller(config *Config, resolver *resolve.Service, conn *GraphQLConn, spool *Spool, metrics *Metrics, changes *ChangeTracker) *Poller {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Poller{
+		config:     config,
+		resolver:   resolver,
+		conn:       conn,
+		spool:      spool,
+		metrics:    metrics,
+		changes:    changes,
+		counters:   NewCounterTracker(),
+		insertMu:   new(sync.Mutex),
+		macSystems: make(map[string]*snmp.Port),
+		ctx:        ctx,
+		cancel:     cancel,
+		mu:         new(sync.Mutex),
+		inFlight:   make(map[int64]bool),
+		wg:         new(sync.WaitGroup),
+	}
+}
+
+// acquire marks the system as being polled, returning false if it's already being polled or the Poller is shut down
+func (p *Poller) acquire(sys *snmp.System) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || p.inFlight[sys.ID] {
+		return false
+	}
+	p.inFlight[sys.ID] = true
+	p.wg.Add(1)
+	return true
+}
+
+func (p *Poller) release(sys *snmp.System) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.inFlight, sys.ID)
+	p.wg.Done()
+}
+
+// Shutdown stops new polls from starting and waits for in-flight polls to finish. If they haven't finished
+// after timeout, they're abandoned and their results are spooled if the spool is enabled. The change state is saved
+// last
+func (p *Poller) Shutdown(timeout time.Duration) {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.Println("WARNING: Abandoning in-flight polls")
+		p.cancel()
+		<-done
+	}
+	p.cancel()
+
+	if p.changes != nil {
+		p.insertMu.Lock()
+		p.saveChanges()
+		p.insertMu.Unlock()
+	}
+}
+
+// Poll polls a single system and inserts the results. It returns nil if the system is already being polled
+// or the Poller is shut down
+func (p *Poller) Poll(sys *snmp.System) *Poll {
+	if !p.acquire(sys) {
+		return nil
+	}
+	defer p.release(sys)
+
+	ctx, cancel := context.WithTimeout(p.ctx, p.config.DeviceTimeout)
+	start := time.Now()
+	info, err := sys.Read(ctx, p.resolver)
+	cancel()
+	poll := &Poll{System: sys, Start: start, End: time.Now(), Info: info, Err: err}
+	p.metrics.RecordPoll(poll)
+
+	if err != nil {
+		info = new(snmp.NetInfo)
+	} else {
+		for _, e := range info.Errors {
+			log.Printf("WARNING: Unable to read %s from system %s:%d: %v\n", e.Collector, sys.Hostname, sys.Port, e.Err)
+		}
+		if p.config.DebugPath != "" {
+			if err := writeDebug(filepath.Join(p.config.DebugPath, sys.Hostname+".json"), info); err != nil {
+				log.Printf("WARNING: could not write snmp info for %s: %v", sys.Hostname, err)
+			}
+		}
+	}
+
+	p.insert(info, []*Poll{poll})
+	return poll
+}
+
+func (p *Poller) insert(info *snmp.NetInfo, polls []*Poll) {
+	p.insertMu.Lock()
+	defer p.insertMu.Unlock()
+
+	j := Translate(info, polls, p.macSystems)
+
+	for _, port := range info.Ports {
+		p.macSystems[port.MacAddress] = port
+	}
+
+	p.counters.Apply(j)
+
+	if p.changes != nil {
+		p.changes.Apply(j)
+		//the state covers every system, so it's saved periodically instead of after every poll
+		if time.Since(p.changesSaved) >= p.config.ChangeStateInterval {
+			p.saveChanges()
+		}
+	}
+
+	p.insertJournal(j)
+}
+
+// saveChanges saves the change state. insertMu must be held
+func (p *Poller) saveChanges() {
+	if err := p.changes.Save(); err != nil {
+		log.Println("WARNING: Unable to save change state:", err)
+		return
+	}
+	p.changesSaved = time.Now()
+}
+
+// insertJournal replays any spooled Journals, then inserts j. If either fails, j is spooled if the spool is enabled
+func (p *Poller) insertJournal(j *Journal) {
+	if p.spool != nil {
+		if n, err := p.spool.Len(); err != nil {
+			log.Println("WARNING: Unable to read spool:", err)
+		} else if n > 0 {
+			log.Printf("INFO: Replaying %d spooled journals\n", n)
+			start := time.Now()
+			rows, err := p.spool.Replay(p.ctx, p.conn.InsertJournal)
+			if err != nil {
+				p.metrics.RecordInsert(0, time.Since(start), err)
+				log.Println("WARNING: Unable to replay spooled journals:", err)
+				if err = p.spool.Write(j); err != nil {
+					log.Println("WARNING: Unable to spool information:", err)
+				}
+				return
+			}
+			log.Println("INFO:", rows, "spooled rows inserted")
+		}
+	}
+
+	log.Println("INFO: Inserting information into database")
+	start := time.Now()
+	rows, err := p.conn.InsertJournal(p.ctx, j)
+	p.metrics.RecordInsert(rows, time.Since(start), err)
+	if err != nil {
+		log.Println("WARNING: Unable to insert information:", err)
+		if p.spool != nil {
+			if err = p.spool.Write(FailedJournal(j, err)); err != nil {
+				log.Println("WARNING: Unable to spool information:", err)
+			}
+		}
+		return
+	}
+	log.Println("INFO:", rows, "rows inserted")
+}
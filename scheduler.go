@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/korylprince/snmp-tracker/snmp"
+)
+
+type scheduled struct {
+	system  *snmp.System
+	next    time.Time
+	running bool
+	// failures is the number of consecutive failed polls
+	failures int
+}
+
+// Scheduler polls each system on its own interval. Start times are spread with random jitter,
+// at most workers systems are polled at once, and a system is never polled concurrently with itself.
+// Systems that fail to be polled are backed off exponentially, up to maxBackoff
+type Scheduler struct {
+	poller          *Poller
+	defaultInterval time.Duration
+	maxBackoff      time.Duration
+	sem             chan struct{}
+
+	mu      *sync.Mutex
+	systems map[int64]*scheduled
+}
+
+// NewScheduler returns a new Scheduler. Systems without a poll interval are polled every defaultInterval
+func NewScheduler(poller *Poller, defaultInterval, maxBackoff time.Duration, workers int) *Scheduler {
+	return &Scheduler{
+		poller:          poller,
+		defaultInterval: defaultInterval,
+		maxBackoff:      maxBackoff,
+		sem:             make(chan struct{}, workers),
+		mu:              new(sync.Mutex),
+		systems:         make(map[int64]*scheduled),
+	}
+}
+
+func (s *Scheduler) interval(sys *snmp.System) time.Duration {
+	if sys.PollInterval > 0 {
+		return time.Second * sys.PollInterval
+	}
+	return s.defaultInterval
+}
+
+// delay returns the time between polls of the system, doubled for each consecutive failure up to maxBackoff
+func (s *Scheduler) delay(sc *scheduled) time.Duration {
+	d := s.interval(sc.system)
+	for i := 0; i < sc.failures && d < s.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > s.maxBackoff && s.maxBackoff > s.interval(sc.system) {
+		d = s.maxBackoff
+	}
+	return d
+}
+
+// SetSystems sets the systems to poll. New systems are scheduled at a random time within their interval,
+// and removed systems are unscheduled. A system whose consecutive failures were reset in the database is
+// scheduled immediately
+func (s *Scheduler) SetSystems(systems []*snmp.System) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[int64]bool)
+	for _, sys := range systems {
+		seen[sys.ID] = true
+		if sc, ok := s.systems[sys.ID]; ok {
+			if sys.Failures == 0 && sc.system.Failures > 0 && sc.failures > 0 && !sc.running {
+				log.Printf("INFO: Backoff of %s reset after %d failed polls\n", sys.Hostname, sc.failures)
+				sc.failures = 0
+				sc.next = time.Now()
+			}
+			sc.system = sys
+			continue
+		}
+		sc := &scheduled{system: sys, failures: sys.Failures}
+		var jitter time.Duration
+		if d := s.delay(sc); d > 0 {
+			jitter = time.Duration(rand.Int63n(int64(d)))
+		}
+		if sc.failures > 0 {
+			log.Printf("INFO: Backing off %s after %d failed polls\n", sys.Hostname, sc.failures)
+		}
+		sc.next = time.Now().Add(jitter)
+		s.systems[sys.ID] = sc
+	}
+
+	for id := range s.systems {
+		if !seen[id] {
+			delete(s.systems, id)
+		}
+	}
+
+	s.poller.metrics.RecordSystems(len(s.systems))
+}
+
+// Trigger schedules an out-of-cycle poll of the system within delay, returning false if the system isn't scheduled
+// or is backed off after failed polls. Polls are still limited to workers at once, and multiple triggers before
+// the poll starts cause a single poll
+func (s *Scheduler) Trigger(sys *snmp.System, delay time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sc, ok := s.systems[sys.ID]
+	if !ok || sc.failures > 0 {
+		return false
+	}
+	if next := time.Now().Add(delay); next.Before(sc.next) {
+		sc.next = next
+	}
+	return true
+}
+
+// Run polls systems as they're due until ctx is canceled. In-flight polls aren't waited for
+func (s *Scheduler) Run(ctx context.Context) {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-t.C:
+		}
+		s.mu.Lock()
+		for _, sc := range s.systems {
+			if sc.running || now.Before(sc.next) {
+				continue
+			}
+			sc.running = true
+			go s.poll(ctx, sc)
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *Scheduler) poll(ctx context.Context, sc *scheduled) {
+	select {
+	case <-ctx.Done():
+		return
+	case s.sem <- struct{}{}:
+	}
+	s.mu.Lock()
+	sys := sc.system
+	s.mu.Unlock()
+
+	start := time.Now()
+	poll := s.poller.Poll(sys)
+	<-s.sem
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sc.running = false
+	if ctx.Err() != nil {
+		//shutting down; don't reschedule
+		return
+	}
+	if poll == nil {
+		//the poller was shut down
+		return
+	}
+
+	//only log changes in state so unreachable systems don't repeat the same warning every poll
+	switch {
+	case poll.Err != nil:
+		sc.failures++
+		if sc.failures == 1 {
+			log.Printf("WARNING: Unable to read system %s:%d, backing off: %v\n", sys.Hostname, sys.Port, poll.Err)
+		}
+	case sc.failures > 0:
+		log.Printf("INFO: System %s:%d recovered after %d failed polls\n", sys.Hostname, sys.Port, sc.failures)
+		sc.failures = 0
+	}
+
+	sc.next = start.Add(s.delay(sc))
+}
@@ -0,0 +1,9 @@
+start transaction;
+
+alter table connection add column version int not null default 3; /* see https://pkg.go.dev/github.com/gosnmp/gosnmp#SnmpVersion */
+
+alter table connection alter column username set default '';
+alter table connection alter column password set default '';
+alter table connection alter column priv_password set default '';
+
+end transaction;
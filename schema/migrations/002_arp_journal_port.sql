@@ -0,0 +1,7 @@
+start transaction;
+
+alter table arp_journal add column port_id bigint references port(id);
+
+create index on arp_journal(port_id);
+
+end transaction;
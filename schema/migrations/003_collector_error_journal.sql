@@ -0,0 +1,13 @@
+start transaction;
+
+create table collector_error_journal (
+    system_id bigint not null references system(id),
+    time timestamp not null,
+    collector text not null,
+    error text not null
+);
+
+create index on collector_error_journal(system_id);
+create index on collector_error_journal(time);
+
+end transaction;
@@ -0,0 +1,40 @@
+start transaction;
+
+alter table system add column last_success timestamp;
+alter table system add column last_error timestamp;
+alter table system add column last_error_message text;
+
+create table system_poll (
+    system_id bigint not null references system(id),
+    start_time timestamp not null,
+    end_time timestamp not null,
+    duration interval generated always as (end_time - start_time) stored,
+    success boolean not null, /* the system was read, even if some collectors failed */
+    error text not null,
+    ports int not null,
+    lldps int not null,
+    mac_addresses int not null,
+    arps int not null,
+    resolves int not null,
+    collector_errors int not null
+);
+
+create index on system_poll(system_id);
+create index on system_poll(start_time);
+
+create function update_system_poll() returns trigger as
+	$$ begin
+		if new.success then
+			update system set last_success = new.end_time where id = new.system_id;
+		end if;
+		if new.error <> '' then
+			update system set last_error = new.end_time, last_error_message = new.error where id = new.system_id;
+		end if;
+		return new;
+	end $$
+language plpgsql;
+
+create trigger update_system_poll after insert on system_poll
+    for each row execute function update_system_poll();
+
+end transaction;
@@ -0,0 +1,17 @@
+start transaction;
+
+alter table port_journal add column last_seen timestamp;
+update port_journal set last_seen = time;
+alter table port_journal alter column last_seen set not null;
+/* ports with duplicate names on a system were journaled once per port */
+delete from port_journal a using port_journal b where a.port_id = b.port_id and a.time = b.time and a.ctid > b.ctid;
+alter table port_journal add constraint unique_port_journal unique(port_id, time);
+
+alter table mac_address_journal add column last_seen timestamp;
+update mac_address_journal set last_seen = time;
+alter table mac_address_journal alter column last_seen set not null;
+delete from mac_address_journal a using mac_address_journal b where a.mac_address_id = b.mac_address_id
+    and a.port_id = b.port_id and a.vlan = b.vlan and a.time = b.time and a.ctid > b.ctid;
+alter table mac_address_journal add constraint unique_mac_address_journal unique(mac_address_id, port_id, vlan, time);
+
+end transaction;
@@ -0,0 +1,5 @@
+start transaction;
+
+alter table system add column poll_interval int; /* seconds, defaults to the PollInterval configuration if null */
+
+end transaction;
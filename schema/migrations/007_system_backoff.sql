@@ -0,0 +1,20 @@
+start transaction;
+
+alter table system add column consecutive_failures int not null default 0; /* set to 0 to reset polling backoff */
+
+create or replace function update_system_poll() returns trigger as
+	$$ begin
+		if new.success then
+			update system set last_success = new.end_time, consecutive_failures = 0 where id = new.system_id;
+		else
+			update system set consecutive_failures = consecutive_failures + 1
+				where id = new.system_id and (last_success is null or last_success < new.end_time);
+		end if;
+		if new.error <> '' then
+			update system set last_error = new.end_time, last_error_message = new.error where id = new.system_id;
+		end if;
+		return new;
+	end $$
+language plpgsql;
+
+end transaction;
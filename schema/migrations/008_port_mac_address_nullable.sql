@@ -0,0 +1,5 @@
+start transaction;
+
+alter table port alter column mac_address_id drop not null; /* null for LLDP neighbors that don't advertise a MAC address */
+
+end transaction;
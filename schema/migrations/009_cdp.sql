@@ -0,0 +1,10 @@
+start transaction;
+
+alter table lldp add column protocol text not null default 'lldp'; /* discovery protocol: lldp or cdp */
+alter table lldp drop constraint unique_lldp;
+alter table lldp add constraint unique_lldp unique(local_port_id, remote_port_id, protocol);
+
+alter table system add column platform text;
+alter table system add column management_address text;
+
+end transaction;
@@ -0,0 +1,6 @@
+start transaction;
+
+alter table system add column description text;
+alter table system add column capabilities text[]; /* LLDP enabled capabilities, e.g. bridge, router, telephone, wlan_access_point */
+
+end transaction;
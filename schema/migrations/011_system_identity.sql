@@ -0,0 +1,37 @@
+start transaction;
+
+alter table system add column chassis_id text; /* LLDP local chassis ID or base bridge MAC address */
+alter table system add column identity text; /* set by set_system_identity */
+update system set identity = name;
+alter table system alter column identity set not null;
+alter table system add constraint unique_system_identity unique(identity);
+alter table system drop constraint unique_system_name;
+create index on system(name);
+create index on system(chassis_id);
+
+/* systems are identified by chassis ID if known, otherwise by name. Systems without a chassis ID are matched to an
+existing system with the same name. A system first identified by name keeps that identity and adopts its chassis ID
+through the upsert, so the trigger never modifies the row the upsert conflicts on */
+create function set_system_identity() returns trigger as
+	$$ declare
+		existing text;
+	begin
+		if new.chassis_id is null then
+			select identity into existing from system where name = new.name order by last_success desc nulls last limit 1;
+			new.identity := coalesce(existing, new.name);
+		else
+			select identity into existing from system where chassis_id = new.chassis_id
+				order by identity = new.chassis_id desc, last_success desc nulls last limit 1;
+			if existing is null then
+				select identity into existing from system where identity = new.name and chassis_id is null;
+			end if;
+			new.identity := coalesce(existing, new.chassis_id);
+		end if;
+		return new;
+	end $$
+language plpgsql;
+
+create trigger set_system_identity before insert on system
+    for each row execute function set_system_identity();
+
+end transaction;
@@ -0,0 +1,88 @@
+start transaction;
+
+/* description was filled from neighbors' lldpRemSysDesc, which would flip with the polled sysDescr */
+alter table system add column neighbor_description text;
+update system set neighbor_description = description, description = null;
+
+alter table system add column object_id text;
+alter table system add column uptime bigint; /* seconds */
+alter table system add column boot_time timestamp;
+alter table system add column location text;
+alter table system add column contact text;
+
+alter table system_poll add column description text;
+alter table system_poll add column object_id text;
+alter table system_poll add column uptime bigint; /* seconds, null if the system couldn't be read */
+alter table system_poll add column location text;
+alter table system_poll add column contact text;
+
+/* uptime is null if the system couldn't be read, so polls with only collector errors still update the system
+group inventory */
+create or replace function update_system_poll() returns trigger as
+	$$ declare
+		booted timestamp;
+		previous timestamp;
+		drift numeric;
+	begin
+		if new.uptime is not null then
+			booted := new.start_time - make_interval(secs => new.uptime);
+			/* sysUpTime wraps every 2^32 centiseconds (about 497 days), which isn't a reboot */
+			select boot_time into previous from system where id = new.system_id;
+			drift := extract(epoch from booted - previous);
+			if drift > 60 and mod(drift + 60, 42949672.96) <= 120 then
+				booted := previous;
+			end if;
+			update system set description = coalesce(new.description, description), object_id = new.object_id,
+				uptime = new.uptime, boot_time = booted, location = new.location, contact = new.contact,
+				consecutive_failures = 0
+				where id = new.system_id;
+		end if;
+		if new.success then
+			update system set last_success = new.end_time where id = new.system_id;
+		else
+			update system set consecutive_failures = consecutive_failures + 1
+				where id = new.system_id and (last_success is null or last_success < new.end_time);
+		end if;
+		if new.error <> '' then
+			update system set last_error = new.end_time, last_error_message = new.error where id = new.system_id;
+		end if;
+		return new;
+	end $$
+language plpgsql;
+
+create table system_journal (
+    system_id bigint not null references system(id),
+    time timestamp not null,
+    description text,
+    object_id text,
+    boot_time timestamp,
+    rebooted boolean not null,
+    location text,
+    contact text
+);
+
+create index on system_journal(system_id);
+create index on system_journal(time);
+
+/* records changes to the system group inventory. Reboots are detected by boot_time moving more than a minute,
+to allow for clock drift between polls */
+create function update_system_journal() returns trigger as
+	$$ declare
+		rebooted boolean := old.boot_time is not null and new.boot_time is not null and
+			abs(extract(epoch from new.boot_time - old.boot_time)) > 60;
+	begin
+		if rebooted or old.description is distinct from new.description or old.object_id is distinct from new.object_id or
+			old.location is distinct from new.location or old.contact is distinct from new.contact or
+			old.boot_time is null and new.boot_time is not null then
+			insert into system_journal(system_id, time, description, object_id, boot_time, rebooted, location, contact)
+				values (new.id, now() at time zone 'utc', new.description, new.object_id, new.boot_time, rebooted,
+					new.location, new.contact);
+		end if;
+		return new;
+	end $$
+language plpgsql;
+
+create trigger update_system_journal after update on system
+    for each row execute function update_system_journal();
+
+end transaction;
@@ -0,0 +1,38 @@
+start transaction;
+
+create table entity (
+    id bigserial primary key,
+    system_id bigint not null references system(id),
+    index int not null, /* entPhysicalIndex */
+    contained_in int not null, /* entPhysicalIndex of the containing entity, or 0 */
+    class text not null,
+    position int not null,
+    name text not null,
+    description text not null,
+    port_id bigint references port(id),
+    constraint unique_entity unique(system_id, index)
+);
+
+create index on entity(system_id);
+create index on entity(port_id);
+
+create table entity_journal (
+    entity_id bigint not null references entity(id),
+    time timestamp not null, /* first seen */
+    last_seen timestamp not null,
+    hardware_rev text not null,
+    firmware_rev text not null,
+    software_rev text not null,
+    serial text not null,
+    manufacturer text not null,
+    model text not null,
+    constraint unique_entity_journal unique(entity_id, hardware_rev, firmware_rev, software_rev, serial, manufacturer, model)
+);
+
+create index on entity_journal(entity_id);
+create index on entity_journal(time);
+create index on entity_journal(serial);
+
+alter table system_poll add column entities int not null default 0;
+
+end transaction;
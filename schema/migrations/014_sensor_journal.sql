@@ -0,0 +1,22 @@
+start transaction;
+
+alter table system add column collect_optics boolean not null default false; /* collect transceiver sensors */
+alter table system_poll add column sensors int not null default 0;
+
+create table sensor_journal (
+    port_id bigint not null references port(id),
+    time timestamp not null,
+    name text not null,
+    type text not null, /* temperature (celsius), bias_current (mA), tx_power and rx_power (dBm), or voltage (V) */
+    value double precision not null,
+    status text not null, /* ok, low_warning, high_warning, low_alarm, high_alarm, or unavailable */
+    low_alarm double precision,
+    low_warning double precision,
+    high_warning double precision,
+    high_alarm double precision
+);
+
+create index on sensor_journal(port_id);
+create index on sensor_journal(time);
+
+end transaction;
@@ -0,0 +1,37 @@
+start transaction;
+
+alter table system_poll add column port_counters int not null default 0;
+
+create table port_counter_journal (
+    port_id bigint not null references port(id),
+    time timestamp not null,
+    in_octets numeric not null,
+    out_octets numeric not null,
+    in_unicast_packets numeric not null,
+    out_unicast_packets numeric not null,
+    in_multicast_packets numeric, /* multicast and broadcast packets are null if the system only has 32 bit counters */
+    out_multicast_packets numeric,
+    in_broadcast_packets numeric,
+    out_broadcast_packets numeric,
+    in_errors numeric not null,
+    out_errors numeric not null,
+    in_discards numeric not null,
+    out_discards numeric not null,
+    /* rates are null for a port's first sample, or if the system rebooted or a counter was reset since the previous sample */
+    interval double precision, /* seconds since the previous sample */
+    in_bps double precision,
+    out_bps double precision,
+    in_pps double precision,
+    out_pps double precision,
+    in_errors_per_second double precision,
+    out_errors_per_second double precision,
+    in_discards_per_second double precision,
+    out_discards_per_second double precision,
+    in_utilization double precision, /* percent of port speed */
+    out_utilization double precision
+);
+
+create index on port_counter_journal(port_id);
+create index on port_counter_journal(time);
+
+end transaction;
@@ -0,0 +1,83 @@
+start transaction;
+
+alter table port add column name_source text; /* ifName or ifDescr for polled ports, lldp or cdp for neighbor ports */
+alter table port add column if_descr text;
+alter table port add column if_type int; /* IANAifType */
+alter table port add column class text; /* ethernet, vlan, loopback, tunnel, aggregate, or other */
+alter table port_journal add column admin_status text;
+
+create index on port(system_id, if_descr);
+create index on port(class);
+
+/* polled ports are named by ifName if it's set, otherwise ifDescr. A neighbor port named by a polled port's ifDescr
+(e.g. from CDP) is matched to the polled port */
+create function set_port_name() returns trigger as
+	$$ declare
+		existing text;
+	begin
+		if new.if_descr is null then
+			select name into existing from port where system_id = new.system_id and if_descr = new.name
+				and not exists (select 1 from port where system_id = new.system_id and name = new.name) limit 1;
+			new.name := coalesce(existing, new.name);
+		end if;
+		return new;
+	end $$
+language plpgsql;
+
+create trigger set_port_name before insert on port
+    for each row execute function set_port_name();
+
+/* moves the history of port old_id to port new_id and deletes old_id. Records that already exist on new_id are kept */
+create function merge_port(old_id bigint, new_id bigint) returns void as
+	$$ begin
+		delete from port_journal o where o.port_id = old_id
+			and exists (select 1 from port_journal n where n.port_id = new_id and n.time = o.time);
+		update port_journal set port_id = new_id where port_id = old_id;
+
+		delete from mac_address_journal o where o.port_id = old_id
+			and exists (select 1 from mac_address_journal n where n.port_id = new_id and n.mac_address_id = o.mac_address_id
+				and n.vlan = o.vlan and n.time = o.time);
+		update mac_address_journal set port_id = new_id where port_id = old_id;
+
+		update arp_journal set port_id = new_id where port_id = old_id;
+		update entity set port_id = new_id where port_id = old_id;
+		update sensor_journal set port_id = new_id where port_id = old_id;
+		update port_counter_journal set port_id = new_id where port_id = old_id;
+
+		/* adjacencies that already exist on new_id take over the journals of the old adjacency */
+		update lldp_journal j set lldp_id = n.id from lldp o, lldp n
+			where j.lldp_id = o.id and (o.local_port_id = old_id or o.remote_port_id = old_id) and n.protocol = o.protocol
+			and n.local_port_id = (case when o.local_port_id = old_id then new_id else o.local_port_id end)
+			and n.remote_port_id = (case when o.remote_port_id = old_id then new_id else o.remote_port_id end);
+		delete from lldp o where (o.local_port_id = old_id or o.remote_port_id = old_id)
+			and exists (select 1 from lldp n where n.protocol = o.protocol
+				and n.local_port_id = (case when o.local_port_id = old_id then new_id else o.local_port_id end)
+				and n.remote_port_id = (case when o.remote_port_id = old_id then new_id else o.remote_port_id end));
+		update lldp set local_port_id = new_id where local_port_id = old_id;
+		update lldp set remote_port_id = new_id where remote_port_id = old_id;
+
+		delete from port where id = old_id;
+	end $$
+language plpgsql;
+
+/* a polled port named by ifName takes over the history of the port named by its ifDescr, created before ports were
+named by ifName or learned from a neighbor. This runs after the row is written so it doesn't modify the row being upserted */
+create function merge_port_if_descr() returns trigger as
+	$$ declare
+		old_id bigint;
+	begin
+		if new.if_descr is not null and new.name <> new.if_descr then
+			select id into old_id from port where system_id = new.system_id and name = new.if_descr and id <> new.id
+				and (name_source is null or name_source not in ('ifName', 'ifDescr'));
+			if old_id is not null then
+				perform merge_port(old_id, new.id);
+			end if;
+		end if;
+		return null;
+	end $$
+language plpgsql;
+
+create trigger merge_port_if_descr after insert or update on port
+    for each row execute function merge_port_if_descr();
+
+end transaction;
@@ -4,6 +4,7 @@ create type transport as enum ('tcp', 'udp');
 
 create table connection (
     id serial primary key,
+    version int not null default 3, /* see https://pkg.go.dev/github.com/gosnmp/gosnmp#SnmpVersion */
     transport transport not null default 'udp',
     community text not null default '',
     timeout int not null default 5,
@@ -13,10 +14,10 @@ create table connection (
     msg_flags int not null default 3, /* see https://pkg.go.dev/github.com/gosnmp/gosnmp#SnmpV3MsgFlags */
     security_model int not null default 3, /* see https://pkg.go.dev/github.com/gosnmp/gosnmp#SnmpV3SecurityModel */
     auth_protocol int not null default 3, /* see https://pkg.go.dev/github.com/gosnmp/gosnmp#SnmpV3AuthProtocol */
-    username text not null,
-    password text not null,
+    username text not null default '',
+    password text not null default '',
     priv_protocol int not null default 3, /* see https://pkg.go.dev/github.com/gosnmp/gosnmp#SnmpV3PrivProtocol */
-    priv_password text not null
+    priv_password text not null default ''
 );
 
 create table hostname (
@@ -26,14 +27,59 @@ create table hostname (
 
 create table system (
     id bigserial primary key,
-    name text constraint unique_system_name unique not null,
+    name text not null,
+    chassis_id text, /* LLDP local chassis ID or base bridge MAC address */
+    identity text constraint unique_system_identity unique not null, /* set by set_system_identity */
     hostname_id bigint references hostname(id),
     port int not null default 161,
-    connection_id int references connection(id)
+    connection_id int references connection(id),
+    poll_interval int, /* seconds, defaults to the PollInterval configuration if null */
+    last_success timestamp,
+    last_error timestamp,
+    last_error_message text,
+    consecutive_failures int not null default 0, /* set to 0 to reset polling backoff */
+    platform text,
+    management_address text,
+    description text, /* sysDescr */
+    neighbor_description text, /* lldpRemSysDesc */
+    capabilities text[], /* LLDP enabled capabilities, e.g. bridge, router, telephone, wlan_access_point */
+    object_id text,
+    uptime bigint, /* seconds */
+    boot_time timestamp,
+    location text,
+    contact text,
+    collect_optics boolean not null default false /* collect transceiver sensors */
 );
 
+create index on system(name);
+create index on system(chassis_id);
 create index on system(hostname_id);
 
+/* systems are identified by chassis ID if known, otherwise by name. Systems without a chassis ID are matched to an
+existing system with the same name. A system first identified by name keeps that identity and adopts its chassis ID
+through the upsert, so the trigger never modifies the row the upsert conflicts on */
+create function set_system_identity() returns trigger as
+	$$ declare
+		existing text;
+	begin
+		if new.chassis_id is null then
+			select identity into existing from system where name = new.name order by last_success desc nulls last limit 1;
+			new.identity := coalesce(existing, new.name);
+		else
+			select identity into existing from system where chassis_id = new.chassis_id
+				order by identity = new.chassis_id desc, last_success desc nulls last limit 1;
+			if existing is null then
+				select identity into existing from system where identity = new.name and chassis_id is null;
+			end if;
+			new.identity := coalesce(existing, new.chassis_id);
+		end if;
+		return new;
+	end $$
+language plpgsql;
+
+create trigger set_system_identity before insert on system
+    for each row execute function set_system_identity();
+
 create table mac_address (
     id bigserial primary key,
     mac_address text constraint unique_mac_address unique not null
@@ -46,21 +92,101 @@ language sql immutable;
 create table port (
     id bigserial primary key,
     system_id bigint not null references system(id),
-    mac_address_id bigint not null references mac_address(id),
+    mac_address_id bigint references mac_address(id), /* null for LLDP neighbors that don't advertise a MAC address */
     name text not null,
+    name_source text, /* ifName or ifDescr for polled ports, lldp or cdp for neighbor ports */
+    if_descr text,
     number int[3] generated always as (port_number(name)) stored,
-    description text not null,
+    description text not null, /* ifAlias */
+    if_type int, /* IANAifType */
+    class text, /* ethernet, vlan, loopback, tunnel, aggregate, or other */
     constraint unique_port_system_name unique(system_id, name)
 );
 
 create index on port(system_id);
 create index on port(mac_address_id);
+create index on port(system_id, if_descr);
+create index on port(class);
+
+/* polled ports are named by ifName if it's set, otherwise ifDescr. A neighbor port named by a polled port's ifDescr
+(e.g. from CDP) is matched to the polled port */
+create function set_port_name() returns trigger as
+	$$ declare
+		existing text;
+	begin
+		if new.if_descr is null then
+			select name into existing from port where system_id = new.system_id and if_descr = new.name
+				and not exists (select 1 from port where system_id = new.system_id and name = new.name) limit 1;
+			new.name := coalesce(existing, new.name);
+		end if;
+		return new;
+	end $$
+language plpgsql;
+
+create trigger set_port_name before insert on port
+    for each row execute function set_port_name();
+
+/* moves the history of port old_id to port new_id and deletes old_id. Records that already exist on new_id are kept */
+create function merge_port(old_id bigint, new_id bigint) returns void as
+	$$ begin
+		delete from port_journal o where o.port_id = old_id
+			and exists (select 1 from port_journal n where n.port_id = new_id and n.time = o.time);
+		update port_journal set port_id = new_id where port_id = old_id;
+
+		delete from mac_address_journal o where o.port_id = old_id
+			and exists (select 1 from mac_address_journal n where n.port_id = new_id and n.mac_address_id = o.mac_address_id
+				and n.vlan = o.vlan and n.time = o.time);
+		update mac_address_journal set port_id = new_id where port_id = old_id;
+
+		update arp_journal set port_id = new_id where port_id = old_id;
+		update entity set port_id = new_id where port_id = old_id;
+		update sensor_journal set port_id = new_id where port_id = old_id;
+		update port_counter_journal set port_id = new_id where port_id = old_id;
+
+		/* adjacencies that already exist on new_id take over the journals of the old adjacency */
+		update lldp_journal j set lldp_id = n.id from lldp o, lldp n
+			where j.lldp_id = o.id and (o.local_port_id = old_id or o.remote_port_id = old_id) and n.protocol = o.protocol
+			and n.local_port_id = (case when o.local_port_id = old_id then new_id else o.local_port_id end)
+			and n.remote_port_id = (case when o.remote_port_id = old_id then new_id else o.remote_port_id end);
+		delete from lldp o where (o.local_port_id = old_id or o.remote_port_id = old_id)
+			and exists (select 1 from lldp n where n.protocol = o.protocol
+				and n.local_port_id = (case when o.local_port_id = old_id then new_id else o.local_port_id end)
+				and n.remote_port_id = (case when o.remote_port_id = old_id then new_id else o.remote_port_id end));
+		update lldp set local_port_id = new_id where local_port_id = old_id;
+		update lldp set remote_port_id = new_id where remote_port_id = old_id;
+
+		delete from port where id = old_id;
+	end $$
+language plpgsql;
+
+/* a polled port named by ifName takes over the history of the port named by its ifDescr, created before ports were
+named by ifName or learned from a neighbor. This runs after the row is written so it doesn't modify the row being upserted */
+create function merge_port_if_descr() returns trigger as
+	$$ declare
+		old_id bigint;
+	begin
+		if new.if_descr is not null and new.name <> new.if_descr then
+			select id into old_id from port where system_id = new.system_id and name = new.if_descr and id <> new.id
+				and (name_source is null or name_source not in ('ifName', 'ifDescr'));
+			if old_id is not null then
+				perform merge_port(old_id, new.id);
+			end if;
+		end if;
+		return null;
+	end $$
+language plpgsql;
+
+create trigger merge_port_if_descr after insert or update on port
+    for each row execute function merge_port_if_descr();
 
 create table port_journal (
     port_id bigint not null references port(id),
     time timestamp not null,
+    last_seen timestamp not null,
     status text not null,
-    speed int not null
+    admin_status text,
+    speed int not null,
+    constraint unique_port_journal unique(port_id, time)
 );
 
 create index on port_journal(port_id);
@@ -70,7 +196,8 @@ create table lldp (
     id bigserial primary key,
     local_port_id bigint not null references port(id),
     remote_port_id bigint not null references port(id),
-    constraint unique_lldp unique(local_port_id, remote_port_id)
+    protocol text not null default 'lldp', /* discovery protocol: lldp or cdp */
+    constraint unique_lldp unique(local_port_id, remote_port_id, protocol)
 );
 
 create index on lldp(local_port_id);
@@ -88,7 +215,9 @@ create table mac_address_journal (
     mac_address_id bigint not null references mac_address(id),
     port_id bigint not null references port(id),
     time timestamp not null,
-    vlan int not null
+    last_seen timestamp not null,
+    vlan int not null,
+    constraint unique_mac_address_journal unique(mac_address_id, port_id, vlan, time)
 );
 
 create index on mac_address_journal(mac_address_id);
@@ -112,10 +241,12 @@ create index on arp(ip_address_id);
 
 create table arp_journal (
     arp_id bigint not null references arp(id),
+    port_id bigint references port(id),
     time timestamp not null
 );
 
 create index on arp_journal(arp_id);
+create index on arp_journal(port_id);
 create index on arp_journal(time);
 
 create table resolve (
@@ -136,6 +267,195 @@ create table resolve_journal (
 create index on resolve_journal(resolve_id);
 create index on resolve_journal(time);
 
+create table collector_error_journal (
+    system_id bigint not null references system(id),
+    time timestamp not null,
+    collector text not null,
+    error text not null
+);
+
+create index on collector_error_journal(system_id);
+create index on collector_error_journal(time);
+
+create table entity (
+    id bigserial primary key,
+    system_id bigint not null references system(id),
+    index int not null, /* entPhysicalIndex */
+    contained_in int not null, /* entPhysicalIndex of the containing entity, or 0 */
+    class text not null,
+    position int not null,
+    name text not null,
+    description text not null,
+    port_id bigint references port(id),
+    constraint unique_entity unique(system_id, index)
+);
+
+create index on entity(system_id);
+create index on entity(port_id);
+
+create table entity_journal (
+    entity_id bigint not null references entity(id),
+    time timestamp not null, /* first seen */
+    last_seen timestamp not null,
+    hardware_rev text not null,
+    firmware_rev text not null,
+    software_rev text not null,
+    serial text not null,
+    manufacturer text not null,
+    model text not null,
+    constraint unique_entity_journal unique(entity_id, hardware_rev, firmware_rev, software_rev, serial, manufacturer, model)
+);
+
+create index on entity_journal(entity_id);
+create index on entity_journal(time);
+create index on entity_journal(serial);
+
+create table sensor_journal (
+    port_id bigint not null references port(id),
+    time timestamp not null,
+    name text not null,
+    type text not null, /* temperature (celsius), bias_current (mA), tx_power and rx_power (dBm), or voltage (V) */
+    value double precision not null,
+    status text not null, /* ok, low_warning, high_warning, low_alarm, high_alarm, or unavailable */
+    low_alarm double precision,
+    low_warning double precision,
+    high_warning double precision,
+    high_alarm double precision
+);
+
+create index on sensor_journal(port_id);
+create index on sensor_journal(time);
+
+create table port_counter_journal (
+    port_id bigint not null references port(id),
+    time timestamp not null,
+    in_octets numeric not null,
+    out_octets numeric not null,
+    in_unicast_packets numeric not null,
+    out_unicast_packets numeric not null,
+    in_multicast_packets numeric, /* multicast and broadcast packets are null if the system only has 32 bit counters */
+    out_multicast_packets numeric,
+    in_broadcast_packets numeric,
+    out_broadcast_packets numeric,
+    in_errors numeric not null,
+    out_errors numeric not null,
+    in_discards numeric not null,
+    out_discards numeric not null,
+    /* rates are null for a port's first sample, or if the system rebooted or a counter was reset since the previous sample */
+    interval double precision, /* seconds since the previous sample */
+    in_bps double precision,
+    out_bps double precision,
+    in_pps double precision,
+    out_pps double precision,
+    in_errors_per_second double precision,
+    out_errors_per_second double precision,
+    in_discards_per_second double precision,
+    out_discards_per_second double precision,
+    in_utilization double precision, /* percent of port speed */
+    out_utilization double precision
+);
+
+create index on port_counter_journal(port_id);
+create index on port_counter_journal(time);
+
+create table system_poll (
+    system_id bigint not null references system(id),
+    start_time timestamp not null,
+    end_time timestamp not null,
+    duration interval generated always as (end_time - start_time) stored,
+    success boolean not null, /* the system was read, even if some collectors failed */
+    error text not null,
+    ports int not null,
+    lldps int not null,
+    mac_addresses int not null,
+    arps int not null,
+    resolves int not null,
+    collector_errors int not null,
+    entities int not null default 0,
+    sensors int not null default 0,
+    port_counters int not null default 0,
+    description text,
+    object_id text,
+    uptime bigint, /* seconds, null if the system couldn't be read */
+    location text,
+    contact text
+);
+
+create index on system_poll(system_id);
+create index on system_poll(start_time);
+
+/* uptime is null if the system couldn't be read, so polls with only collector errors still update the system
+group inventory */
+create function update_system_poll() returns trigger as
+	$$ declare
+		booted timestamp;
+		previous timestamp;
+		drift numeric;
+	begin
+		if new.uptime is not null then
+			booted := new.start_time - make_interval(secs => new.uptime);
+			/* sysUpTime wraps every 2^32 centiseconds (about 497 days), which isn't a reboot */
+			select boot_time into previous from system where id = new.system_id;
+			drift := extract(epoch from booted - previous);
+			if drift > 60 and mod(drift + 60, 42949672.96) <= 120 then
+				booted := previous;
+			end if;
+			update system set description = coalesce(new.description, description), object_id = new.object_id,
+				uptime = new.uptime, boot_time = booted, location = new.location, contact = new.contact,
+				consecutive_failures = 0
+				where id = new.system_id;
+		end if;
+		if new.success then
+			update system set last_success = new.end_time where id = new.system_id;
+		else
+			update system set consecutive_failures = consecutive_failures + 1
+				where id = new.system_id and (last_success is null or last_success < new.end_time);
+		end if;
+		if new.error <> '' then
+			update system set last_error = new.end_time, last_error_message = new.error where id = new.system_id;
+		end if;
+		return new;
+	end $$
+language plpgsql;
+
+create trigger update_system_poll after insert on system_poll
+    for each row execute function update_system_poll();
+
+create table system_journal (
+    system_id bigint not null references system(id),
+    time timestamp not null,
+    description text,
+    object_id text,
+    boot_time timestamp,
+    rebooted boolean not null,
+    location text,
+    contact text
+);
+
+create index on system_journal(system_id);
+create index on system_journal(time);
+
+/* records changes to the system group inventory. Reboots are detected by boot_time moving more than a minute,
+to allow for clock drift between polls */
+create function update_system_journal() returns trigger as
+	$$ declare
+		rebooted boolean := old.boot_time is not null and new.boot_time is not null and
+			abs(extract(epoch from new.boot_time - old.boot_time)) > 60;
+	begin
+		if rebooted or old.description is distinct from new.description or old.object_id is distinct from new.object_id or
+			old.location is distinct from new.location or old.contact is distinct from new.contact or
+			old.boot_time is null and new.boot_time is not null then
+			insert into system_journal(system_id, time, description, object_id, boot_time, rebooted, location, contact)
+				values (new.id, now() at time zone 'utc', new.description, new.object_id, new.boot_time, rebooted,
+					new.location, new.contact);
+		end if;
+		return new;
+	end $$
+language plpgsql;
+
+create trigger update_system_journal after update on system
+    for each row execute function update_system_journal();
+
 create table vendor (
     prefix text primary key,
     name text not null
@@ -1,49 +1,168 @@
 package snmp
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"net"
+	"strconv"
 	"strings"
 
 	"github.com/gosnmp/gosnmp"
 )
 
 const (
-	snmpARPTablePrefix        = ".1.3.6.1.2.1.4.35.1.4"
-	snmpPhysicalAddressTypeIP = "1"
+	snmpARPTablePrefix       = ".1.3.6.1.2.1.4.35.1.4"
+	snmpLegacyARPTablePrefix = ".1.3.6.1.2.1.4.22.1.2"
+	snmpLegacyARPTypePrefix  = ".1.3.6.1.2.1.4.22.1.4"
+
+	snmpLegacyARPTypeInvalid = 2
+
+	// InetAddressType values, see RFC 4001
+	snmpInetAddressTypeIPv4  = 1
+	snmpInetAddressTypeIPv6  = 2
+	snmpInetAddressTypeIPv4z = 3
+	snmpInetAddressTypeIPv6z = 4
 )
 
-// Arp is an ARP record
+// Arp is an ARP (or IPv6 neighbor) record
 type Arp struct {
 	MacAddress string
 	IPAddress  string
+	// Port is the interface the record was learned on, or nil if it's unknown
+	Port    *Port
+	ifIndex string
+}
+
+// parseOIDInetAddress parses an InetAddressType, InetAddress pair from its OID representation (.type.length.d.d...).
+// Zoned addresses are returned with the zone index appended, e.g. fe80::1%5
+func parseOIDInetAddress(split []string) (string, error) {
+	if len(split) < 2 {
+		return "", fmt.Errorf("Expected at least 2 parts, got %d", len(split))
+	}
+	typ, err := strconv.Atoi(split[0])
+	if err != nil {
+		return "", fmt.Errorf("Couldn't parse address type: %w", err)
+	}
+	length, err := strconv.Atoi(split[1])
+	if err != nil {
+		return "", fmt.Errorf("Couldn't parse address length: %w", err)
+	}
+	if len(split)-2 != length {
+		return "", fmt.Errorf("Expected address length %d, got %d", length, len(split)-2)
+	}
+
+	octets := make([]byte, 0, length)
+	for _, s := range split[2:] {
+		dec, err := strconv.ParseUint(s, 10, 8)
+		if err != nil {
+			return "", fmt.Errorf("Couldn't parse address: %w", err)
+		}
+		octets = append(octets, uint8(dec))
+	}
+
+	var ipLen int
+	switch typ {
+	case snmpInetAddressTypeIPv4, snmpInetAddressTypeIPv4z:
+		ipLen = net.IPv4len
+	case snmpInetAddressTypeIPv6, snmpInetAddressTypeIPv6z:
+		ipLen = net.IPv6len
+	default:
+		return "", fmt.Errorf("Unknown address type: %d", typ)
+	}
+
+	zoned := typ == snmpInetAddressTypeIPv4z || typ == snmpInetAddressTypeIPv6z
+	if (!zoned && length != ipLen) || (zoned && length != ipLen+4) {
+		return "", fmt.Errorf("Invalid address length %d for type %d", length, typ)
+	}
+
+	ip := net.IP(octets[:ipLen]).String()
+	if !zoned {
+		return ip, nil
+	}
+
+	zone := uint32(octets[ipLen])<<24 | uint32(octets[ipLen+1])<<16 | uint32(octets[ipLen+2])<<8 | uint32(octets[ipLen+3])
+	if zone == 0 {
+		return ip, nil
+	}
+
+	return fmt.Sprintf("%s%%%d", ip, zone), nil
 }
 
-func getARPs(snmp *gosnmp.GoSNMP) ([]*Arp, error) {
-	pdus, err := walkOIDs(snmp, []string{
+func getARPs(ctx context.Context, snmp *gosnmp.GoSNMP) ([]*Arp, error) {
+	pdus, err := walkOIDs(ctx, snmp, []string{
 		snmpARPTablePrefix,
 	})
-	if err != nil {
-		return nil, fmt.Errorf("Failed to walk for ARP table: %w", err)
+	//fall back to RFC1213 ipNetToMediaTable if ipNetToPhysicalTable isn't implemented
+	if err != nil || len(pdus[snmpARPTablePrefix]) == 0 {
+		arps, lerr := getLegacyARPs(ctx, snmp)
+		if lerr != nil {
+			if err != nil {
+				return nil, fmt.Errorf("Failed to walk for ARP table: %w", err)
+			}
+			return nil, lerr
+		}
+		return arps, nil
 	}
 
 	arps := make([]*Arp, 0, len(pdus[snmpARPTablePrefix]))
 
 	for _, pdu := range pdus[snmpARPTablePrefix] {
+		//returned OID is .ifIndex.type.length.d.d... where d is decimal version of the address
 		oid := strings.TrimPrefix(pdu.Name, string(snmpARPTablePrefix)+".")
 		split := strings.Split(oid, ".")
-		if len(split) != 7 || split[1] != snmpPhysicalAddressTypeIP {
-			return nil, fmt.Errorf("Unknown ARP table entry: %s", oid)
+		ip, err := parseOIDInetAddress(split[1:])
+		if err != nil {
+			log.Printf("WARNING: %s unknown ARP table entry %s: %v\n", snmp.Target, oid, err)
+			continue
+		}
+		mac := net.HardwareAddr(pdu.Value.([]byte))
+		//incomplete IPv6 neighbors have no physical address
+		if len(mac) == 0 || mac.String() == unknownMacAddress {
+			continue
+		}
+		arps = append(arps, &Arp{MacAddress: mac.String(), IPAddress: ip, ifIndex: "." + split[0]})
+	}
+
+	return arps, nil
+}
+
+func getLegacyARPs(ctx context.Context, snmp *gosnmp.GoSNMP) ([]*Arp, error) {
+	pdus, err := walkOIDs(ctx, snmp, []string{
+		snmpLegacyARPTablePrefix,
+		snmpLegacyARPTypePrefix,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to walk for legacy ARP table: %w", err)
+	}
+
+	invalid := make(map[string]bool)
+	for _, pdu := range pdus[snmpLegacyARPTypePrefix] {
+		id := strings.TrimPrefix(pdu.Name, snmpLegacyARPTypePrefix)
+		invalid[id] = pdu.Value.(int) == snmpLegacyARPTypeInvalid
+	}
+
+	arps := make([]*Arp, 0, len(pdus[snmpLegacyARPTablePrefix]))
+
+	for _, pdu := range pdus[snmpLegacyARPTablePrefix] {
+		//returned OID is .ifIndex.d.d.d.d where d is decimal version of the IPv4 address
+		id := strings.TrimPrefix(pdu.Name, snmpLegacyARPTablePrefix)
+		if invalid[id] {
+			continue
+		}
+		split := strings.Split(id, ".")
+		if len(split) != 6 {
+			return nil, fmt.Errorf("Error parsing id: Expected split 6, got %d", len(split))
 		}
-		ip := strings.Join(split[3:], ".")
+		ip := strings.Join(split[2:], ".")
 		if net.ParseIP(ip) == nil {
 			return nil, fmt.Errorf("Unable to parse IP: %s", ip)
 		}
 		mac := net.HardwareAddr(pdu.Value.([]byte))
-		if mac.String() == unknownMacAddress {
+		if len(mac) == 0 || mac.String() == unknownMacAddress {
 			continue
 		}
-		arps = append(arps, &Arp{MacAddress: mac.String(), IPAddress: ip})
+		arps = append(arps, &Arp{MacAddress: mac.String(), IPAddress: ip, ifIndex: "." + split[1]})
 	}
 
 	return arps, nil
@@ -0,0 +1,134 @@
+package snmp
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+const (
+	snmpBridgeFdbPortPrefix   = ".1.3.6.1.2.1.17.4.3.1.2"
+	snmpBridgeFdbStatusPrefix = ".1.3.6.1.2.1.17.4.3.1.3"
+	snmpCiscoVlanStatePrefix  = ".1.3.6.1.4.1.9.9.46.1.3.1.1.2"
+
+	snmpBridgeFdbStatusLearned    = 3
+	snmpCiscoVlanStateOperational = 1
+)
+
+func getBridgeMacAddresses(ctx context.Context, snmp *gosnmp.GoSNMP, portTbl map[string]*Port, vlan int) ([]*MacAddress, error) {
+	bridgeTbl, err := getBridgePortTable(ctx, snmp)
+	if err != nil {
+		return nil, err
+	}
+
+	pdus, err := walkOIDs(ctx, snmp, []string{
+		snmpBridgeFdbPortPrefix,
+		snmpBridgeFdbStatusPrefix,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to walk for bridge MAC table: %w", err)
+	}
+
+	status := make(map[string]int)
+	for _, pdu := range pdus[snmpBridgeFdbStatusPrefix] {
+		id := strings.TrimPrefix(pdu.Name, snmpBridgeFdbStatusPrefix)
+		status[id] = pdu.Value.(int)
+	}
+
+	macs := make([]*MacAddress, 0, len(pdus[snmpBridgeFdbPortPrefix]))
+
+	for _, pdu := range pdus[snmpBridgeFdbPortPrefix] {
+		//returned OID is .d.d.d.d.d.d where d is decimal version of MAC address
+		id := strings.TrimPrefix(pdu.Name, snmpBridgeFdbPortPrefix)
+
+		//skip the device's own addresses
+		if s, ok := status[id]; ok && s != snmpBridgeFdbStatusLearned {
+			continue
+		}
+
+		split := strings.Split(id, ".")
+		if len(split) != 7 {
+			return nil, fmt.Errorf("Error parsing id: Expected split 7, got %d", len(split))
+		}
+		mac, err := parseOIDMacAddress(split[1:])
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing id: %w", err)
+		}
+		if mac.String() == unknownMacAddress {
+			continue
+		}
+
+		port, ok := bridgeTbl.lookup(portTbl, pdu.Value.(int))
+		if !ok {
+			log.Printf("WARNING: %s mac address %s has unknown bridge port: %d\n", snmp.Target, mac.String(), pdu.Value.(int))
+			continue
+		}
+
+		macs = append(macs, &MacAddress{
+			MacAddress: mac.String(),
+			Port:       port,
+			Vlan:       vlan,
+		})
+	}
+
+	return macs, nil
+}
+
+func getCiscoVlans(ctx context.Context, snmp *gosnmp.GoSNMP) ([]int, error) {
+	pdus, err := walkOIDs(ctx, snmp, []string{
+		snmpCiscoVlanStatePrefix,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to walk for VLAN table: %w", err)
+	}
+
+	vlans := make([]int, 0, len(pdus[snmpCiscoVlanStatePrefix]))
+
+	for _, pdu := range pdus[snmpCiscoVlanStatePrefix] {
+		//returned OID is .domain.vlan
+		id := strings.TrimPrefix(pdu.Name, snmpCiscoVlanStatePrefix)
+		split := strings.Split(id, ".")
+		if len(split) != 3 {
+			return nil, fmt.Errorf("Error parsing id: Expected split 3, got %d", len(split))
+		}
+		vlan, err := strconv.Atoi(split[2])
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing id: Couldn't parse VLAN: %w", err)
+		}
+		//skip reserved FDDI and Token Ring VLANs
+		if vlan >= 1002 && vlan <= 1005 {
+			continue
+		}
+		if pdu.Value.(int) == snmpCiscoVlanStateOperational {
+			vlans = append(vlans, vlan)
+		}
+	}
+
+	return vlans, nil
+}
+
+func getCiscoVlanMacAddresses(ctx context.Context, snmp *gosnmp.GoSNMP, config *ConnectionConfig, portTbl map[string]*Port, vlans []int) ([]*MacAddress, error) {
+	var macs []*MacAddress
+
+	for _, vlan := range vlans {
+		vs := config.NewVlan(snmp.Target, snmp.Port, vlan)
+		vs.OnRecv = snmp.OnRecv
+		vs.Context = ctx
+		if err := vs.Connect(); err != nil {
+			return nil, fmt.Errorf("Failed to open SNMP connection for VLAN %d: %w", vlan, err)
+		}
+		m, err := getBridgeMacAddresses(ctx, vs, portTbl, vlan)
+		vs.Conn.Close()
+		if err != nil {
+			log.Printf("WARNING: %s unable to read MAC table for VLAN %d: %v\n", snmp.Target, vlan, err)
+			continue
+		}
+		macs = append(macs, m...)
+	}
+
+	return macs, nil
+}
@@ -0,0 +1,110 @@
+package snmp
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// CISCO-CDP-MIB cdpCacheTable, indexed by ifIndex and device index
+const (
+	snmpCDPAddressTypePrefix = ".1.3.6.1.4.1.9.9.23.1.2.1.1.3"
+	snmpCDPAddressPrefix     = ".1.3.6.1.4.1.9.9.23.1.2.1.1.4"
+	snmpCDPDeviceIDPrefix    = ".1.3.6.1.4.1.9.9.23.1.2.1.1.6"
+	snmpCDPDevicePortPrefix  = ".1.3.6.1.4.1.9.9.23.1.2.1.1.7"
+	snmpCDPPlatformPrefix    = ".1.3.6.1.4.1.9.9.23.1.2.1.1.8"
+
+	snmpCDPAddressTypeIP = 1
+
+	//sysObjectID prefix of Cisco devices
+	snmpCiscoObjectIDPrefix = ".1.3.6.1.4.1.9."
+)
+
+// cdpSupported returns true if a system with the given sysObjectID may support CDP. CDP is Cisco proprietary,
+// so other vendors' systems aren't walked. Systems that don't report a sysObjectID are assumed to support it
+func cdpSupported(objectID string) bool {
+	return objectID == "" || strings.HasPrefix(objectID, snmpCiscoObjectIDPrefix)
+}
+
+// cdpDeviceName strips the serial number some platforms append to the device ID, e.g. switch(FOX1234ABCD)
+func cdpDeviceName(id string) string {
+	if idx := strings.IndexByte(id, '('); idx > 0 && strings.HasSuffix(id, ")") {
+		return id[:idx]
+	}
+	return id
+}
+
+func getCDPs(ctx context.Context, snmp *gosnmp.GoSNMP, portTbl map[string]*Port) ([]*LLDP, error) {
+	pdus, err := walkOIDs(ctx, snmp, []string{
+		snmpCDPAddressTypePrefix,
+		snmpCDPAddressPrefix,
+		snmpCDPDeviceIDPrefix,
+		snmpCDPDevicePortPrefix,
+		snmpCDPPlatformPrefix,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to walk for CDP table: %w", err)
+	}
+
+	cache := make(map[string]*LLDP)
+	cdps := make([]*LLDP, 0, len(pdus[snmpCDPDeviceIDPrefix]))
+
+	for _, pdu := range pdus[snmpCDPDeviceIDPrefix] {
+		oid := strings.TrimPrefix(pdu.Name, snmpCDPDeviceIDPrefix)
+		split := strings.Split(oid, ".")
+		if len(split) != 3 {
+			return nil, fmt.Errorf("Error parsing id: Expected split 3, got %d", len(split))
+		}
+		id := "." + split[1]
+		l := &LLDP{
+			LocalPort:  portTbl[id],
+			RemotePort: &Port{SystemName: cdpDeviceName(string(pdu.Value.([]byte)))},
+			Protocol:   ProtocolCDP,
+			id:         id,
+		}
+		cache[oid] = l
+		cdps = append(cdps, l)
+	}
+	for _, pdu := range pdus[snmpCDPDevicePortPrefix] {
+		oid := strings.TrimPrefix(pdu.Name, snmpCDPDevicePortPrefix)
+		if l, ok := cache[oid]; ok {
+			l.RemotePort.Name = string(pdu.Value.([]byte))
+		}
+	}
+	for _, pdu := range pdus[snmpCDPPlatformPrefix] {
+		oid := strings.TrimPrefix(pdu.Name, snmpCDPPlatformPrefix)
+		if l, ok := cache[oid]; ok {
+			l.RemotePlatform = string(pdu.Value.([]byte))
+		}
+	}
+	addrTypes := make(map[string]int)
+	for _, pdu := range pdus[snmpCDPAddressTypePrefix] {
+		addrTypes[strings.TrimPrefix(pdu.Name, snmpCDPAddressTypePrefix)] = pdu.Value.(int)
+	}
+	for _, pdu := range pdus[snmpCDPAddressPrefix] {
+		oid := strings.TrimPrefix(pdu.Name, snmpCDPAddressPrefix)
+		addr := pdu.Value.([]byte)
+		if l, ok := cache[oid]; ok && addrTypes[oid] == snmpCDPAddressTypeIP && (len(addr) == 4 || len(addr) == 16) {
+			l.RemoteAddress = net.IP(addr).String()
+		}
+	}
+
+	filtered := make([]*LLDP, 0, len(cdps))
+	for _, l := range cdps {
+		if l.LocalPort == nil || l.LocalPort.Name == "" || l.LocalPort.MacAddress == "" || l.LocalPort.MacAddress == unknownMacAddress {
+			log.Printf("WARNING: %s cdp %s has unknown local port: %#v\n", snmp.Target, l.id, l.LocalPort)
+			continue
+		}
+		if l.RemotePort.SystemName == "" || l.RemotePort.Name == "" {
+			log.Printf("WARNING: %s cdp %s has unknown remote port: %#v\n", snmp.Target, l.id, l.RemotePort)
+			continue
+		}
+		filtered = append(filtered, l)
+	}
+
+	return filtered, nil
+}
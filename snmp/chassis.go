@@ -0,0 +1,43 @@
+package snmp
+
+import (
+	"context"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+const (
+	snmpLLDPLocChassisSubType = ".1.0.8802.1.1.2.1.3.1.0"
+	snmpLLDPLocChassisID      = ".1.0.8802.1.1.2.1.3.2.0"
+	snmpBridgeBaseAddress     = ".1.3.6.1.2.1.17.1.1.0"
+)
+
+// getChassisID returns a stable identity for the system that survives renames. The LLDP local chassis ID is
+// preferred, since it's formatted the same as the remote chassis IDs neighbors report, then the base bridge MAC address.
+// An empty string is returned if neither is available
+func getChassisID(ctx context.Context, snmp *gosnmp.GoSNMP) string {
+	//SNMPv1 agents fail the whole request if any OID is missing, so each source is requested separately
+	pdus, err := getOIDs(ctx, snmp, []string{snmpLLDPLocChassisSubType, snmpLLDPLocChassisID})
+	if err == nil {
+		subType, id := pdus[snmpLLDPLocChassisSubType], pdus[snmpLLDPLocChassisID]
+		if subType.Type == gosnmp.Integer && id.Type == gosnmp.OctetString && len(id.Value.([]byte)) > 0 {
+			r := &lldpRemote{chassisSubType: subType.Value.(int), chassisID: id.Value.([]byte)}
+			if chassis := r.chassis(); chassis != unknownMacAddress {
+				return chassis
+			}
+		}
+	}
+
+	pdus, err = getOIDs(ctx, snmp, []string{snmpBridgeBaseAddress})
+	if err != nil {
+		return ""
+	}
+	if pdu := pdus[snmpBridgeBaseAddress]; pdu.Type == gosnmp.OctetString && len(pdu.Value.([]byte)) == 6 {
+		r := &lldpRemote{chassisSubType: snmpLLDPChassisSubTypeMacAddress, chassisID: pdu.Value.([]byte)}
+		if chassis := r.chassis(); chassis != unknownMacAddress {
+			return chassis
+		}
+	}
+
+	return ""
+}
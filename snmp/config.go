@@ -1,6 +1,7 @@
 package snmp
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/gosnmp/gosnmp"
@@ -8,6 +9,7 @@ import (
 
 // ConnectionConfig is configuration for a connection
 type ConnectionConfig struct {
+	Version        gosnmp.SnmpVersion         `json:"version"`
 	Transport      string                     `json:"transport"`
 	Community      string                     `json:"community"`
 	Timeout        time.Duration              `json:"timeout"`
@@ -23,26 +25,43 @@ type ConnectionConfig struct {
 	PrivPassword   string                     `json:"priv_password"`
 }
 
-// New returns a new SNMP configuration
+// New returns a new SNMP configuration. Community is used for SNMPv1 and SNMPv2c and the USM parameters are used for SNMPv3
 func (c *ConnectionConfig) New(host string, port uint16) *gosnmp.GoSNMP {
-	return &gosnmp.GoSNMP{
+	snmp := &gosnmp.GoSNMP{
 		Target:         host,
 		Port:           port,
-		Version:        gosnmp.Version3,
+		Version:        c.Version,
 		Transport:      c.Transport,
 		Community:      c.Community,
 		Timeout:        time.Second * c.Timeout,
 		Retries:        c.Retries,
 		MaxOids:        c.MaxOIDs,
 		MaxRepetitions: c.MaxRepetitions,
-		MsgFlags:       c.MsgFlags,
-		SecurityModel:  c.SecurityModel,
-		SecurityParameters: &gosnmp.UsmSecurityParameters{
+	}
+
+	if c.Version == gosnmp.Version3 {
+		snmp.MsgFlags = c.MsgFlags
+		snmp.SecurityModel = c.SecurityModel
+		snmp.SecurityParameters = &gosnmp.UsmSecurityParameters{
 			AuthenticationProtocol:   c.AuthProtocol,
 			UserName:                 c.Username,
 			AuthenticationPassphrase: c.AuthPassword,
 			PrivacyProtocol:          c.PrivProtocol,
 			PrivacyPassphrase:        c.PrivPassword,
-		},
+		}
+	}
+
+	return snmp
+}
+
+// NewVlan returns a new SNMP configuration for the given VLAN's bridge instance,
+// using Cisco's community string indexing (community@vlan) or SNMPv3 context (vlan-<vlan>)
+func (c *ConnectionConfig) NewVlan(host string, port uint16, vlan int) *gosnmp.GoSNMP {
+	snmp := c.New(host, port)
+	if c.Version == gosnmp.Version3 {
+		snmp.ContextName = fmt.Sprintf("vlan-%d", vlan)
+	} else {
+		snmp.Community = fmt.Sprintf("%s@%d", c.Community, vlan)
 	}
+	return snmp
 }
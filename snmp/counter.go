@@ -0,0 +1,153 @@
+package snmp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+const (
+	//IF-MIB ifXTable high capacity counters
+	snmpPortHCInOctetsPrefix     = ".1.3.6.1.2.1.31.1.1.1.6"
+	snmpPortHCInUnicastPrefix    = ".1.3.6.1.2.1.31.1.1.1.7"
+	snmpPortHCInMulticastPrefix  = ".1.3.6.1.2.1.31.1.1.1.8"
+	snmpPortHCInBroadcastPrefix  = ".1.3.6.1.2.1.31.1.1.1.9"
+	snmpPortHCOutOctetsPrefix    = ".1.3.6.1.2.1.31.1.1.1.10"
+	snmpPortHCOutUnicastPrefix   = ".1.3.6.1.2.1.31.1.1.1.11"
+	snmpPortHCOutMulticastPrefix = ".1.3.6.1.2.1.31.1.1.1.12"
+	snmpPortHCOutBroadcastPrefix = ".1.3.6.1.2.1.31.1.1.1.13"
+	snmpPortInOctetsPrefix       = ".1.3.6.1.2.1.2.2.1.10"
+	snmpPortInUnicastPrefix      = ".1.3.6.1.2.1.2.2.1.11"
+	snmpPortInNonUnicastPrefix   = ".1.3.6.1.2.1.2.2.1.12"
+	snmpPortInDiscardsPrefix     = ".1.3.6.1.2.1.2.2.1.13"
+	snmpPortInErrorsPrefix       = ".1.3.6.1.2.1.2.2.1.14"
+	snmpPortOutOctetsPrefix      = ".1.3.6.1.2.1.2.2.1.16"
+	snmpPortOutUnicastPrefix     = ".1.3.6.1.2.1.2.2.1.17"
+	snmpPortOutNonUnicastPrefix  = ".1.3.6.1.2.1.2.2.1.18"
+	snmpPortOutDiscardsPrefix    = ".1.3.6.1.2.1.2.2.1.19"
+	snmpPortOutErrorsPrefix      = ".1.3.6.1.2.1.2.2.1.20"
+)
+
+// PortCounters are the traffic counters of a port. Bits is the width of the octet and packet counters:
+// 64 for the ifXTable high capacity counters, or 32 if only the ifTable counters are available, in which case
+// multicast and broadcast packets are only counted together as non-unicast packets. Counters the device doesn't
+// report are nil. Error and discard counters are always 32 bits
+type PortCounters struct {
+	Bits          int
+	InOctets      uint64
+	OutOctets     uint64
+	InUnicast     uint64
+	OutUnicast    uint64
+	InMulticast   *uint64
+	OutMulticast  *uint64
+	InBroadcast   *uint64
+	OutBroadcast  *uint64
+	InNonUnicast  *uint64
+	OutNonUnicast *uint64
+	InErrors      uint64
+	OutErrors     uint64
+	InDiscards    uint64
+	OutDiscards   uint64
+}
+
+func getPortCounters(ctx context.Context, snmp *gosnmp.GoSNMP, portTbl map[string]*Port) error {
+	counters := make(map[string]*PortCounters)
+	counter := func(id string) *PortCounters {
+		if _, ok := portTbl[id]; !ok {
+			return nil
+		}
+		c, ok := counters[id]
+		if !ok {
+			c = new(PortCounters)
+			counters[id] = c
+		}
+		return c
+	}
+	read := func(pdus map[string][]gosnmp.SnmpPDU, prefix string, field func(*PortCounters) *uint64) {
+		for _, pdu := range pdus[prefix] {
+			if c := counter(strings.TrimPrefix(pdu.Name, prefix)); c != nil {
+				*field(c) = gosnmp.ToBigInt(pdu.Value).Uint64()
+			}
+		}
+	}
+	readOptional := func(pdus map[string][]gosnmp.SnmpPDU, prefix string, field func(*PortCounters) **uint64) {
+		for _, pdu := range pdus[prefix] {
+			if c := counter(strings.TrimPrefix(pdu.Name, prefix)); c != nil {
+				v := gosnmp.ToBigInt(pdu.Value).Uint64()
+				*field(c) = &v
+			}
+		}
+	}
+
+	bits := 32
+	//Counter64 doesn't exist in SNMPv1
+	if snmp.Version != gosnmp.Version1 {
+		pdus, err := walkOIDs(ctx, snmp, []string{
+			snmpPortHCInOctetsPrefix,
+			snmpPortHCInUnicastPrefix,
+			snmpPortHCInMulticastPrefix,
+			snmpPortHCInBroadcastPrefix,
+			snmpPortHCOutOctetsPrefix,
+			snmpPortHCOutUnicastPrefix,
+			snmpPortHCOutMulticastPrefix,
+			snmpPortHCOutBroadcastPrefix,
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to walk for high capacity counters: %w", err)
+		}
+		if len(pdus[snmpPortHCInOctetsPrefix]) > 0 {
+			bits = 64
+			read(pdus, snmpPortHCInOctetsPrefix, func(c *PortCounters) *uint64 { return &c.InOctets })
+			read(pdus, snmpPortHCInUnicastPrefix, func(c *PortCounters) *uint64 { return &c.InUnicast })
+			readOptional(pdus, snmpPortHCInMulticastPrefix, func(c *PortCounters) **uint64 { return &c.InMulticast })
+			readOptional(pdus, snmpPortHCInBroadcastPrefix, func(c *PortCounters) **uint64 { return &c.InBroadcast })
+			read(pdus, snmpPortHCOutOctetsPrefix, func(c *PortCounters) *uint64 { return &c.OutOctets })
+			read(pdus, snmpPortHCOutUnicastPrefix, func(c *PortCounters) *uint64 { return &c.OutUnicast })
+			readOptional(pdus, snmpPortHCOutMulticastPrefix, func(c *PortCounters) **uint64 { return &c.OutMulticast })
+			readOptional(pdus, snmpPortHCOutBroadcastPrefix, func(c *PortCounters) **uint64 { return &c.OutBroadcast })
+		}
+	}
+
+	oids := []string{
+		snmpPortInDiscardsPrefix,
+		snmpPortInErrorsPrefix,
+		snmpPortOutDiscardsPrefix,
+		snmpPortOutErrorsPrefix,
+	}
+	if bits == 32 {
+		oids = append(oids,
+			snmpPortInOctetsPrefix,
+			snmpPortInUnicastPrefix,
+			snmpPortInNonUnicastPrefix,
+			snmpPortOutOctetsPrefix,
+			snmpPortOutUnicastPrefix,
+			snmpPortOutNonUnicastPrefix,
+		)
+	}
+	pdus, err := walkOIDs(ctx, snmp, oids)
+	if err != nil {
+		return fmt.Errorf("Failed to walk for counters: %w", err)
+	}
+	read(pdus, snmpPortInDiscardsPrefix, func(c *PortCounters) *uint64 { return &c.InDiscards })
+	read(pdus, snmpPortInErrorsPrefix, func(c *PortCounters) *uint64 { return &c.InErrors })
+	read(pdus, snmpPortOutDiscardsPrefix, func(c *PortCounters) *uint64 { return &c.OutDiscards })
+	read(pdus, snmpPortOutErrorsPrefix, func(c *PortCounters) *uint64 { return &c.OutErrors })
+	if bits == 32 {
+		read(pdus, snmpPortInOctetsPrefix, func(c *PortCounters) *uint64 { return &c.InOctets })
+		read(pdus, snmpPortInUnicastPrefix, func(c *PortCounters) *uint64 { return &c.InUnicast })
+		read(pdus, snmpPortOutOctetsPrefix, func(c *PortCounters) *uint64 { return &c.OutOctets })
+		read(pdus, snmpPortOutUnicastPrefix, func(c *PortCounters) *uint64 { return &c.OutUnicast })
+		//ifInNUcastPkts and ifOutNUcastPkts are deprecated, but are the only 32 bit multicast and broadcast counters
+		readOptional(pdus, snmpPortInNonUnicastPrefix, func(c *PortCounters) **uint64 { return &c.InNonUnicast })
+		readOptional(pdus, snmpPortOutNonUnicastPrefix, func(c *PortCounters) **uint64 { return &c.OutNonUnicast })
+	}
+
+	for id, c := range counters {
+		c.Bits = bits
+		portTbl[id].Counters = c
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package snmp
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// ENTITY-MIB entPhysicalTable and entAliasMappingTable
+const (
+	snmpEntityDescriptionPrefix  = ".1.3.6.1.2.1.47.1.1.1.1.2"
+	snmpEntityContainedInPrefix  = ".1.3.6.1.2.1.47.1.1.1.1.4"
+	snmpEntityClassPrefix        = ".1.3.6.1.2.1.47.1.1.1.1.5"
+	snmpEntityPositionPrefix     = ".1.3.6.1.2.1.47.1.1.1.1.6"
+	snmpEntityNamePrefix         = ".1.3.6.1.2.1.47.1.1.1.1.7"
+	snmpEntityHardwareRevPrefix  = ".1.3.6.1.2.1.47.1.1.1.1.8"
+	snmpEntityFirmwareRevPrefix  = ".1.3.6.1.2.1.47.1.1.1.1.9"
+	snmpEntitySoftwareRevPrefix  = ".1.3.6.1.2.1.47.1.1.1.1.10"
+	snmpEntitySerialPrefix       = ".1.3.6.1.2.1.47.1.1.1.1.11"
+	snmpEntityManufacturerPrefix = ".1.3.6.1.2.1.47.1.1.1.1.12"
+	snmpEntityModelPrefix        = ".1.3.6.1.2.1.47.1.1.1.1.13"
+	snmpEntityAliasPrefix        = ".1.3.6.1.2.1.47.1.3.2.1.2"
+
+	snmpIfIndexPrefix = ".1.3.6.1.2.1.2.2.1.1"
+)
+
+// PhysicalClass
+var entityClasses = map[int]string{
+	1:  "other",
+	2:  "unknown",
+	3:  "chassis",
+	4:  "backplane",
+	5:  "container",
+	6:  "power_supply",
+	7:  "fan",
+	8:  "sensor",
+	9:  "module",
+	10: "port",
+	11: "stack",
+	12: "cpu",
+}
+
+// Entity is a physical component of a device, e.g. a chassis, stack member, line card or transceiver.
+// ContainedIn is the Index of the containing entity, or 0 if it isn't contained in another entity.
+// Port is the port the entity is mapped to, if any
+type Entity struct {
+	Index        int
+	ContainedIn  int
+	Class        string
+	Position     int
+	Name         string
+	Description  string
+	HardwareRev  string
+	FirmwareRev  string
+	SoftwareRev  string
+	Serial       string
+	Manufacturer string
+	Model        string
+	Port         *Port
+}
+
+func getEntities(ctx context.Context, snmp *gosnmp.GoSNMP, portTbl map[string]*Port) ([]*Entity, error) {
+	pdus, err := walkOIDs(ctx, snmp, []string{
+		snmpEntityClassPrefix,
+		snmpEntityDescriptionPrefix,
+		snmpEntityContainedInPrefix,
+		snmpEntityPositionPrefix,
+		snmpEntityNamePrefix,
+		snmpEntityHardwareRevPrefix,
+		snmpEntityFirmwareRevPrefix,
+		snmpEntitySoftwareRevPrefix,
+		snmpEntitySerialPrefix,
+		snmpEntityManufacturerPrefix,
+		snmpEntityModelPrefix,
+		snmpEntityAliasPrefix,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to walk for entities: %w", err)
+	}
+
+	cache := make(map[string]*Entity)
+	entities := make([]*Entity, 0, len(pdus[snmpEntityClassPrefix]))
+
+	for _, pdu := range pdus[snmpEntityClassPrefix] {
+		id := strings.TrimPrefix(pdu.Name, snmpEntityClassPrefix)
+		idx, err := strconv.Atoi(strings.TrimPrefix(id, "."))
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing id: %w", err)
+		}
+		class, ok := entityClasses[pdu.Value.(int)]
+		if !ok {
+			class = entityClasses[2]
+		}
+		e := &Entity{Index: idx, Class: class}
+		cache[id] = e
+		entities = append(entities, e)
+	}
+
+	for _, pdu := range pdus[snmpEntityContainedInPrefix] {
+		if e, ok := cache[strings.TrimPrefix(pdu.Name, snmpEntityContainedInPrefix)]; ok {
+			e.ContainedIn = pdu.Value.(int)
+		}
+	}
+	for _, pdu := range pdus[snmpEntityPositionPrefix] {
+		if e, ok := cache[strings.TrimPrefix(pdu.Name, snmpEntityPositionPrefix)]; ok {
+			e.Position = pdu.Value.(int)
+		}
+	}
+
+	for prefix, field := range map[string]func(*Entity) *string{
+		snmpEntityDescriptionPrefix:  func(e *Entity) *string { return &e.Description },
+		snmpEntityNamePrefix:         func(e *Entity) *string { return &e.Name },
+		snmpEntityHardwareRevPrefix:  func(e *Entity) *string { return &e.HardwareRev },
+		snmpEntityFirmwareRevPrefix:  func(e *Entity) *string { return &e.FirmwareRev },
+		snmpEntitySoftwareRevPrefix:  func(e *Entity) *string { return &e.SoftwareRev },
+		snmpEntitySerialPrefix:       func(e *Entity) *string { return &e.Serial },
+		snmpEntityManufacturerPrefix: func(e *Entity) *string { return &e.Manufacturer },
+		snmpEntityModelPrefix:        func(e *Entity) *string { return &e.Model },
+	} {
+		for _, pdu := range pdus[prefix] {
+			if e, ok := cache[strings.TrimPrefix(pdu.Name, prefix)]; ok {
+				*field(e) = strings.TrimSpace(pduString(pdu))
+			}
+		}
+	}
+
+	//entAliasMappingIdentifier is indexed by entity and logical entity, and points to ifIndex.<ifIndex>
+	for _, pdu := range pdus[snmpEntityAliasPrefix] {
+		split := strings.Split(strings.TrimPrefix(pdu.Name, snmpEntityAliasPrefix), ".")
+		if len(split) != 3 {
+			continue
+		}
+		alias := pduString(pdu)
+		if !strings.HasPrefix(alias, snmpIfIndexPrefix+".") {
+			continue
+		}
+		if e, ok := cache["."+split[1]]; ok {
+			e.Port = portTbl[strings.TrimPrefix(alias, snmpIfIndexPrefix)]
+		}
+	}
+
+	return entities, nil
+}
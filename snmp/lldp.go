@@ -1,93 +1,364 @@
 package snmp
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
+	"strconv"
 	"strings"
 
 	"github.com/gosnmp/gosnmp"
 )
 
 const (
-	snmpLLDPSystemPrefix      = ".1.0.8802.1.1.2.1.4.1.1.9.0"
-	snmpLLDPPortPrefix        = ".1.0.8802.1.1.2.1.4.1.1.8.0"
-	snmpLLDPPortSubTypePrefix = ".1.0.8802.1.1.2.1.4.1.1.6.0"
-	snmpLLDPMacAddressPrefix  = ".1.0.8802.1.1.2.1.4.1.1.7.0"
+	snmpLLDPLocPortSubTypePrefix = ".1.0.8802.1.1.2.1.3.7.1.2"
+	snmpLLDPLocPortIDPrefix      = ".1.0.8802.1.1.2.1.3.7.1.3"
+	snmpLLDPLocPortDescPrefix    = ".1.0.8802.1.1.2.1.3.7.1.4"
 
-	snmpLLDPSubTypeMacAddress = 3
+	snmpLLDPChassisSubTypePrefix = ".1.0.8802.1.1.2.1.4.1.1.4.0"
+	snmpLLDPChassisPrefix        = ".1.0.8802.1.1.2.1.4.1.1.5.0"
+	snmpLLDPPortSubTypePrefix    = ".1.0.8802.1.1.2.1.4.1.1.6.0"
+	snmpLLDPPortIDPrefix         = ".1.0.8802.1.1.2.1.4.1.1.7.0"
+	snmpLLDPPortPrefix           = ".1.0.8802.1.1.2.1.4.1.1.8.0"
+	snmpLLDPSystemPrefix         = ".1.0.8802.1.1.2.1.4.1.1.9.0"
+	snmpLLDPSystemDescPrefix     = ".1.0.8802.1.1.2.1.4.1.1.10.0"
+	snmpLLDPSystemCapPrefix      = ".1.0.8802.1.1.2.1.4.1.1.12.0"
+
+	//lldpRemManAddrIfSubtype; the address is part of the index
+	snmpLLDPManAddrPrefix = ".1.0.8802.1.1.2.1.4.2.1.3.0"
+
+	//LldpChassisIdSubtype
+	snmpLLDPChassisSubTypeMacAddress     = 4
+	snmpLLDPChassisSubTypeNetworkAddress = 5
+
+	//LldpPortIdSubtype
+	snmpLLDPSubTypeInterfaceAlias = 1
+	snmpLLDPSubTypeMacAddress     = 3
+	snmpLLDPSubTypeNetworkAddress = 4
+	snmpLLDPSubTypeInterfaceName  = 5
+	snmpLLDPSubTypeLocal          = 7
+
+	//IANA address families used by the networkAddress subtypes
+	ianaAddressFamilyIPv4 = 1
+	ianaAddressFamilyIPv6 = 2
+)
+
+// LLDP system capabilities, in LldpSystemCapabilitiesMap bit order
+var lldpCapabilities = []string{
+	"other",
+	"repeater",
+	"bridge",
+	"wlan_access_point",
+	"router",
+	"telephone",
+	"docsis_cable_device",
+	"station_only",
+}
+
+// parseLLDPCapabilities returns the names of the capabilities set in the BITS value
+func parseLLDPCapabilities(bits []byte) []string {
+	caps := make([]string, 0)
+	for i, name := range lldpCapabilities {
+		if i/8 < len(bits) && bits[i/8]&(0x80>>(i%8)) != 0 {
+			caps = append(caps, name)
+		}
+	}
+	return caps
+}
+
+// Discovery protocols
+const (
+	ProtocolLLDP = "lldp"
+	ProtocolCDP  = "cdp"
 )
 
-// LLDP is an LLDP record
+// LLDP is a neighbor adjacency learned by a discovery protocol
 type LLDP struct {
 	LocalPort  *Port
 	RemotePort *Port
-	id         string
+	Protocol   string
+	// RemotePlatform, RemoteAddress, RemoteDescription and RemoteCapabilities describe the remote system, if advertised
+	RemotePlatform     string
+	RemoteAddress      string
+	RemoteDescription  string
+	RemoteCapabilities []string
+	id                 string
 }
 
-func getLLDPs(snmp *gosnmp.GoSNMP, portTbl map[string]*Port) ([]*LLDP, error) {
-	pdus, err := walkOIDs(snmp, []string{
-		snmpLLDPSystemPrefix,
-		snmpLLDPPortPrefix,
-		snmpLLDPPortSubTypePrefix,
-		snmpLLDPMacAddressPrefix,
+// lldpRemote is the identity advertised by an LLDP neighbor
+type lldpRemote struct {
+	chassisSubType int
+	chassisID      []byte
+	portSubType    int
+	portID         []byte
+	portDesc       string
+	sysName        string
+	sysDesc        string
+	sysCaps        []string
+	manAddr        string
+}
+
+// formatLLDPID formats a chassis or port ID according to its subtype
+func formatLLDPID(id []byte, isMac, isAddr bool) string {
+	switch {
+	case isMac && len(id) == 6:
+		return net.HardwareAddr(id).String()
+	case isAddr && len(id) == 5 && id[0] == ianaAddressFamilyIPv4:
+		return net.IP(id[1:]).String()
+	case isAddr && len(id) == 17 && id[0] == ianaAddressFamilyIPv6:
+		return net.IP(id[1:]).String()
+	}
+	return string(id)
+}
+
+func (r *lldpRemote) chassis() string {
+	return formatLLDPID(r.chassisID, r.chassisSubType == snmpLLDPChassisSubTypeMacAddress, r.chassisSubType == snmpLLDPChassisSubTypeNetworkAddress)
+}
+
+func (r *lldpRemote) port() string {
+	return formatLLDPID(r.portID, r.portSubType == snmpLLDPSubTypeMacAddress, r.portSubType == snmpLLDPSubTypeNetworkAddress)
+}
+
+// toPort builds the remote port from whichever identifiers the neighbor advertised. The system is identified by the
+// chassis ID, and its name falls back to the chassis ID. The port name is the port ID if it's an interface name, otherwise the port description, and the
+// MAC address is taken from the port ID or chassis ID if either is a MAC address
+func (r *lldpRemote) toPort() *Port {
+	p := &Port{SystemName: r.sysName, ChassisID: r.chassis(), Name: r.portDesc}
+	if p.SystemName == "" {
+		p.SystemName = p.ChassisID
+	}
+	if p.ChassisID == unknownMacAddress {
+		p.ChassisID = ""
+	}
+
+	switch r.portSubType {
+	case snmpLLDPSubTypeInterfaceName, snmpLLDPSubTypeInterfaceAlias, snmpLLDPSubTypeLocal:
+		if id := r.port(); id != "" {
+			p.Name = id
+		}
+	case snmpLLDPSubTypeMacAddress:
+		if len(r.portID) == 6 {
+			p.MacAddress = r.port()
+		}
+	}
+	if p.Name == "" {
+		p.Name = r.port()
+	}
+
+	if p.MacAddress == "" && r.chassisSubType == snmpLLDPChassisSubTypeMacAddress && len(r.chassisID) == 6 {
+		p.MacAddress = r.chassis()
+	}
+	if p.MacAddress == unknownMacAddress {
+		p.MacAddress = ""
+	}
+
+	return p
+}
+
+// getLLDPLocalPorts maps LLDP local port numbers to ports using lldpLocPortTable, since lldpLocPortNum is often
+// numbered independently of ifIndex. Ports are matched by the port ID according to its subtype, then by the port
+// description as ifDescr, ifName, or ifAlias. Local port numbers that can't be matched are assumed to be the ifIndex
+func getLLDPLocalPorts(ctx context.Context, snmp *gosnmp.GoSNMP, portTbl map[string]*Port) (map[string]*Port, error) {
+	pdus, err := walkOIDs(ctx, snmp, []string{
+		snmpLLDPLocPortSubTypePrefix,
+		snmpLLDPLocPortIDPrefix,
+		snmpLLDPLocPortDescPrefix,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("Failed to walk for LLDP table: %w", err)
+		return nil, fmt.Errorf("Failed to walk for LLDP local port table: %w", err)
 	}
 
-	cache := make(map[string]*LLDP)
-	lldps := make([]*LLDP, 0, len(pdus[snmpLLDPSystemPrefix]))
+	byName := make(map[string]*Port)
+	byDescr := make(map[string]*Port)
+	byDesc := make(map[string]*Port)
+	byMac := make(map[string]*Port)
+	dupMacs := make(map[string]bool)
+	for _, p := range portTbl {
+		byName[p.Name] = p
+		byDescr[p.IfDescr] = p
+		byDesc[p.Description] = p
+		if _, ok := byMac[p.MacAddress]; ok {
+			dupMacs[p.MacAddress] = true
+		}
+		byMac[p.MacAddress] = p
+	}
+	//ports commonly share the system MAC address, so it only identifies a port if it's unique
+	for mac := range dupMacs {
+		delete(byMac, mac)
+	}
 
-	for _, pdu := range pdus[snmpLLDPSystemPrefix] {
-		oid := strings.TrimPrefix(pdu.Name, string(snmpLLDPSystemPrefix))
-		split := strings.Split(oid, ".")
-		if len(split) != 3 {
-			return nil, fmt.Errorf("Error parsing id: Expected split 3, got %d", len(split))
+	subTypes := make(map[string]int)
+	for _, pdu := range pdus[snmpLLDPLocPortSubTypePrefix] {
+		subTypes[strings.TrimPrefix(pdu.Name, snmpLLDPLocPortSubTypePrefix)] = pdu.Value.(int)
+	}
+
+	tbl := make(map[string]*Port)
+	for id, p := range portTbl {
+		tbl[id] = p
+	}
+	matched := make(map[string]bool)
+
+	for _, pdu := range pdus[snmpLLDPLocPortIDPrefix] {
+		id := strings.TrimPrefix(pdu.Name, snmpLLDPLocPortIDPrefix)
+		val := pdu.Value.([]byte)
+		if len(val) == 0 {
+			continue
 		}
-		id := "." + split[1]
-		//guard against empty duplicates
-		rSysName := string(pdu.Value.([]byte))
-		if rSysName != "" {
-			l := &LLDP{LocalPort: portTbl[id], RemotePort: &Port{SystemName: rSysName}, id: id}
-			cache[oid] = l
-			lldps = append(lldps, l)
+		var p *Port
+		switch subTypes[id] {
+		case snmpLLDPSubTypeInterfaceName:
+			if p = byName[string(val)]; p == nil {
+				p = byDescr[string(val)]
+			}
+		case snmpLLDPSubTypeInterfaceAlias:
+			p = byDesc[string(val)]
+		case snmpLLDPSubTypeMacAddress:
+			if len(val) == 6 {
+				p = byMac[net.HardwareAddr(val).String()]
+			}
+		case snmpLLDPSubTypeLocal:
+			//many platforms advertise the ifIndex as the local port ID
+			if p = portTbl["."+string(val)]; p == nil {
+				p = byName[string(val)]
+			}
+		}
+		if p != nil {
+			tbl[id] = p
+			matched[id] = true
 		}
 	}
-	for _, pdu := range pdus[snmpLLDPPortPrefix] {
-		oid := strings.TrimPrefix(pdu.Name, string(snmpLLDPPortPrefix))
-		portName := string(pdu.Value.([]byte))
-		if cache[oid] != nil && portName != "" {
-			cache[oid].RemotePort.Name = portName
+
+	for _, pdu := range pdus[snmpLLDPLocPortDescPrefix] {
+		id := strings.TrimPrefix(pdu.Name, snmpLLDPLocPortDescPrefix)
+		desc := string(pdu.Value.([]byte))
+		if matched[id] || desc == "" {
+			continue
+		}
+		if p, ok := byDescr[desc]; ok {
+			tbl[id] = p
+		} else if p, ok := byName[desc]; ok {
+			tbl[id] = p
+		} else if p, ok := byDesc[desc]; ok {
+			tbl[id] = p
 		}
 	}
-	for _, pdu := range pdus[snmpLLDPPortSubTypePrefix] {
-		oid := strings.TrimPrefix(pdu.Name, string(snmpLLDPPortSubTypePrefix))
-		if pdu.Value.(int) == snmpLLDPSubTypeMacAddress && cache[oid] != nil {
-			cache[oid].RemotePort.MacAddress = "valid"
+
+	return tbl, nil
+}
+
+func getLLDPs(ctx context.Context, snmp *gosnmp.GoSNMP, portTbl map[string]*Port) ([]*LLDP, error) {
+	localTbl, err := getLLDPLocalPorts(ctx, snmp, portTbl)
+	if err != nil {
+		log.Printf("WARNING: %s: %v, assuming LLDP local port numbers are ifIndexes\n", snmp.Target, err)
+		localTbl = portTbl
+	}
+
+	pdus, err := walkOIDs(ctx, snmp, []string{
+		snmpLLDPChassisSubTypePrefix,
+		snmpLLDPChassisPrefix,
+		snmpLLDPPortSubTypePrefix,
+		snmpLLDPPortIDPrefix,
+		snmpLLDPPortPrefix,
+		snmpLLDPSystemPrefix,
+		snmpLLDPSystemDescPrefix,
+		snmpLLDPSystemCapPrefix,
+		snmpLLDPManAddrPrefix,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to walk for LLDP table: %w", err)
+	}
+
+	//lldpRemTable is indexed by time mark, local port number and remote index
+	remotes := make(map[string]*lldpRemote)
+	oids := make([]string, 0, len(pdus[snmpLLDPChassisPrefix]))
+	remote := func(oid string) *lldpRemote {
+		r, ok := remotes[oid]
+		if !ok {
+			r = new(lldpRemote)
+			remotes[oid] = r
+			oids = append(oids, oid)
 		}
+		return r
 	}
 
-	for _, pdu := range pdus[snmpLLDPMacAddressPrefix] {
-		oid := strings.TrimPrefix(pdu.Name, string(snmpLLDPMacAddressPrefix))
-		mac := net.HardwareAddr(pdu.Value.([]byte))
-		if cache[oid] != nil && cache[oid].RemotePort.MacAddress == "valid" {
-			cache[oid].RemotePort.MacAddress = mac.String()
+	for _, pdu := range pdus[snmpLLDPChassisSubTypePrefix] {
+		remote(strings.TrimPrefix(pdu.Name, snmpLLDPChassisSubTypePrefix)).chassisSubType = pdu.Value.(int)
+	}
+	for _, pdu := range pdus[snmpLLDPChassisPrefix] {
+		remote(strings.TrimPrefix(pdu.Name, snmpLLDPChassisPrefix)).chassisID = pdu.Value.([]byte)
+	}
+	for _, pdu := range pdus[snmpLLDPPortSubTypePrefix] {
+		remote(strings.TrimPrefix(pdu.Name, snmpLLDPPortSubTypePrefix)).portSubType = pdu.Value.(int)
+	}
+	for _, pdu := range pdus[snmpLLDPPortIDPrefix] {
+		remote(strings.TrimPrefix(pdu.Name, snmpLLDPPortIDPrefix)).portID = pdu.Value.([]byte)
+	}
+	for _, pdu := range pdus[snmpLLDPPortPrefix] {
+		remote(strings.TrimPrefix(pdu.Name, snmpLLDPPortPrefix)).portDesc = string(pdu.Value.([]byte))
+	}
+	for _, pdu := range pdus[snmpLLDPSystemPrefix] {
+		remote(strings.TrimPrefix(pdu.Name, snmpLLDPSystemPrefix)).sysName = string(pdu.Value.([]byte))
+	}
+	for _, pdu := range pdus[snmpLLDPSystemDescPrefix] {
+		remote(strings.TrimPrefix(pdu.Name, snmpLLDPSystemDescPrefix)).sysDesc = string(pdu.Value.([]byte))
+	}
+	for _, pdu := range pdus[snmpLLDPSystemCapPrefix] {
+		remote(strings.TrimPrefix(pdu.Name, snmpLLDPSystemCapPrefix)).sysCaps = parseLLDPCapabilities(pdu.Value.([]byte))
+	}
+	for _, pdu := range pdus[snmpLLDPManAddrPrefix] {
+		//index is local port, remote index, address subtype, address length, address
+		split := strings.Split(strings.TrimPrefix(pdu.Name, snmpLLDPManAddrPrefix), ".")
+		if len(split) < 5 {
+			continue
+		}
+		if split[3] != strconv.Itoa(ianaAddressFamilyIPv4) && split[3] != strconv.Itoa(ianaAddressFamilyIPv6) {
+			continue
+		}
+		r, ok := remotes["."+split[1]+"."+split[2]]
+		if !ok {
+			continue
+		}
+		addr, err := parseOIDInetAddress(split[3:])
+		if err != nil {
+			log.Printf("WARNING: %s lldp has invalid management address %s: %v\n", snmp.Target, pdu.Name, err)
+			continue
+		}
+		//prefer IPv4 addresses
+		if r.manAddr == "" || split[3] == strconv.Itoa(ianaAddressFamilyIPv4) && strings.Contains(r.manAddr, ":") {
+			r.manAddr = addr
 		}
 	}
 
-	filtered := make([]*LLDP, 0, len(lldps))
-	for _, l := range lldps {
+	lldps := make([]*LLDP, 0, len(oids))
+	for _, oid := range oids {
+		split := strings.Split(oid, ".")
+		if len(split) != 3 {
+			return nil, fmt.Errorf("Error parsing id: Expected split 3, got %d", len(split))
+		}
+		id := "." + split[1]
+		r := remotes[oid]
+		l := &LLDP{
+			LocalPort:          localTbl[id],
+			RemotePort:         r.toPort(),
+			Protocol:           ProtocolLLDP,
+			RemoteAddress:      r.manAddr,
+			RemoteDescription:  r.sysDesc,
+			RemoteCapabilities: r.sysCaps,
+			id:                 id,
+		}
+
 		if l.LocalPort == nil || l.LocalPort.Name == "" || l.LocalPort.MacAddress == "" || l.LocalPort.MacAddress == unknownMacAddress {
 			log.Printf("WARNING: %s lldp %s has unknown local port: %#v\n", snmp.Target, l.id, l.LocalPort)
 			continue
 		}
-		if l.RemotePort == nil || l.RemotePort.Name == "" || l.RemotePort.MacAddress == "" || l.RemotePort.MacAddress == unknownMacAddress {
+		//guard against empty duplicates
+		if l.RemotePort.SystemName == "" || l.RemotePort.Name == "" {
 			log.Printf("WARNING: %s lldp %s has unknown remote port: %#v\n", snmp.Target, l.id, l.RemotePort)
 			continue
 		}
-		filtered = append(filtered, l)
+		lldps = append(lldps, l)
 	}
 
-	return filtered, nil
+	return lldps, nil
 }
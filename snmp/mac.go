@@ -1,6 +1,7 @@
 package snmp
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
@@ -11,7 +12,8 @@ import (
 )
 
 const (
-	snmpMacTablePortPrefix = ".1.3.6.1.2.1.17.7.1.2.2.1.2"
+	snmpMacTablePortPrefix      = ".1.3.6.1.2.1.17.7.1.2.2.1.2"
+	snmpBridgePortIfIndexPrefix = ".1.3.6.1.2.1.17.1.4.1.2"
 
 	unknownMacAddress = "00:00:00:00:00:00"
 )
@@ -23,8 +25,61 @@ type MacAddress struct {
 	Vlan       int
 }
 
-func getMacAddresses(snmp *gosnmp.GoSNMP, portTbl map[string]*Port) ([]*MacAddress, error) {
-	pdus, err := walkOIDs(snmp, []string{
+// bridgePortTable maps dot1dBasePort numbers to ifIndexes
+type bridgePortTable map[int]int
+
+func getBridgePortTable(ctx context.Context, snmp *gosnmp.GoSNMP) (bridgePortTable, error) {
+	pdus, err := walkOIDs(ctx, snmp, []string{
+		snmpBridgePortIfIndexPrefix,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to walk for bridge port table: %w", err)
+	}
+
+	tbl := make(bridgePortTable, len(pdus[snmpBridgePortIfIndexPrefix]))
+
+	for _, pdu := range pdus[snmpBridgePortIfIndexPrefix] {
+		id := strings.TrimPrefix(pdu.Name, snmpBridgePortIfIndexPrefix+".")
+		basePort, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing id: Couldn't parse bridge port: %w", err)
+		}
+		tbl[basePort] = pdu.Value.(int)
+	}
+
+	return tbl, nil
+}
+
+// lookup returns the port for the given bridge port. If the bridge port isn't in the table, it's assumed to equal the ifIndex
+func (b bridgePortTable) lookup(portTbl map[string]*Port, basePort int) (*Port, bool) {
+	ifIndex, ok := b[basePort]
+	if !ok {
+		ifIndex = basePort
+	}
+	port, ok := portTbl["."+strconv.Itoa(ifIndex)]
+	return port, ok
+}
+
+// parseOIDMacAddress parses a MAC address from its decimal OID representation
+func parseOIDMacAddress(split []string) (net.HardwareAddr, error) {
+	var mac net.HardwareAddr
+	for _, s := range split {
+		dec, err := strconv.ParseUint(s, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't parse Mac address: %w", err)
+		}
+		mac = append(mac, uint8(dec))
+	}
+	return mac, nil
+}
+
+func getMacAddresses(ctx context.Context, snmp *gosnmp.GoSNMP, config *ConnectionConfig, portTbl map[string]*Port) ([]*MacAddress, error) {
+	bridgeTbl, err := getBridgePortTable(ctx, snmp)
+	if err != nil {
+		return nil, err
+	}
+
+	pdus, err := walkOIDs(ctx, snmp, []string{
 		snmpMacTablePortPrefix,
 	})
 	if err != nil {
@@ -45,21 +100,17 @@ func getMacAddresses(snmp *gosnmp.GoSNMP, portTbl map[string]*Port) ([]*MacAddre
 		if err != nil {
 			return nil, fmt.Errorf("Error parsing id: Couldn't parse VLAN: %w", err)
 		}
-		var mac net.HardwareAddr
-		for _, s := range split[2:] {
-			dec, err := strconv.ParseUint(s, 10, 8)
-			if err != nil {
-				return nil, fmt.Errorf("Error parsing id: Couldn't parse Mac address: %w", err)
-			}
-			mac = append(mac, uint8(dec))
+		mac, err := parseOIDMacAddress(split[2:])
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing id: %w", err)
 		}
 		if mac.String() == unknownMacAddress {
 			continue
 		}
 
-		port, ok := portTbl["."+strconv.Itoa(pdu.Value.(int))]
+		port, ok := bridgeTbl.lookup(portTbl, pdu.Value.(int))
 		if !ok {
-			log.Printf("WARNING: %s mac address %s has unknown port: %d\n", snmp.Target, mac.String(), pdu.Value.(int))
+			log.Printf("WARNING: %s mac address %s has unknown bridge port: %d\n", snmp.Target, mac.String(), pdu.Value.(int))
 			continue
 		}
 
@@ -70,5 +121,19 @@ func getMacAddresses(snmp *gosnmp.GoSNMP, portTbl map[string]*Port) ([]*MacAddre
 		})
 	}
 
-	return macs, nil
+	if len(pdus[snmpMacTablePortPrefix]) > 0 {
+		return macs, nil
+	}
+
+	//Cisco only exposes the BRIDGE-MIB per VLAN; the plain community only returns VLAN 1
+	vlans, err := getCiscoVlans(ctx, snmp)
+	if err != nil {
+		return nil, err
+	}
+	if len(vlans) > 0 {
+		return getCiscoVlanMacAddresses(ctx, snmp, config, portTbl, vlans)
+	}
+
+	//fall back to BRIDGE-MIB if Q-BRIDGE-MIB isn't implemented
+	return getBridgeMacAddresses(ctx, snmp, portTbl, 0)
 }
@@ -2,8 +2,10 @@
 package snmp
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
 
 	"github.com/gosnmp/gosnmp"
@@ -11,12 +13,44 @@ import (
 
 const (
 	snmpPortMacAddressPrefix  = ".1.3.6.1.2.1.2.2.1.6"
-	snmpPortNamePrefix        = ".1.3.6.1.2.1.2.2.1.2"
+	snmpPortNamePrefix        = ".1.3.6.1.2.1.31.1.1.1.1"
+	snmpPortDescrPrefix       = ".1.3.6.1.2.1.2.2.1.2"
 	snmpPortDescriptionPrefix = ".1.3.6.1.2.1.31.1.1.1.18"
+	snmpPortTypePrefix        = ".1.3.6.1.2.1.2.2.1.3"
+	snmpPortAdminStatusPrefix = ".1.3.6.1.2.1.2.2.1.7"
 	snmpPortLinkStatusPrefix  = ".1.3.6.1.2.1.2.2.1.8"
 	snmpPortSpeedPrefix       = ".1.3.6.1.2.1.31.1.1.1.15"
 )
 
+// port name sources
+const (
+	PortNameSourceIfName  = "ifName"
+	PortNameSourceIfDescr = "ifDescr"
+)
+
+// IANAifType values used to classify ports
+const (
+	ifTypeEthernetCsmacd   = 6
+	ifTypeSoftwareLoopback = 24
+	ifTypePropVirtual      = 53
+	ifTypeFastEther        = 62
+	ifTypeGigabitEthernet  = 117
+	ifTypeTunnel           = 131
+	ifTypeL2Vlan           = 135
+	ifTypeL3IPVlan         = 136
+	ifTypeIEEE8023adLag    = 161
+)
+
+// port classes
+const (
+	PortClassEthernet  = "ethernet"
+	PortClassVlan      = "vlan"
+	PortClassLoopback  = "loopback"
+	PortClassTunnel    = "tunnel"
+	PortClassAggregate = "aggregate"
+	PortClassOther     = "other"
+)
+
 // LinkStatusType is type of link statuses
 type LinkStatusType int
 
@@ -31,21 +65,61 @@ const (
 	LinkStatusLowerLayerDown LinkStatusType = 7
 )
 
-// Port is a switch port
+// Port is a switch port. Name is ifName if the system supports it, otherwise ifDescr. Description is ifAlias
 type Port struct {
 	SystemName  string
+	ChassisID   string
+	IfIndex     int
 	MacAddress  string
 	Name        string
+	NameSource  string
+	IfDescr     string
 	Description string
+	Type        int
+	AdminStatus LinkStatusType
 	LinkStatus  LinkStatusType
 	Speed       uint
+	Counters    *PortCounters
+}
+
+// Class returns the class of the port from its ifType. Virtual ports are classified by name,
+// since some platforms use propVirtual for both VLAN interfaces and port channels
+func (p *Port) Class() string {
+	switch p.Type {
+	case ifTypeEthernetCsmacd, ifTypeFastEther, ifTypeGigabitEthernet:
+		return PortClassEthernet
+	case ifTypeL2Vlan, ifTypeL3IPVlan:
+		return PortClassVlan
+	case ifTypeSoftwareLoopback:
+		return PortClassLoopback
+	case ifTypeTunnel:
+		return PortClassTunnel
+	case ifTypeIEEE8023adLag:
+		return PortClassAggregate
+	case ifTypePropVirtual:
+		name := strings.ToLower(p.Name)
+		switch {
+		case strings.HasPrefix(name, "vl"), strings.HasPrefix(name, "irb"):
+			return PortClassVlan
+		case strings.HasPrefix(name, "po"), strings.HasPrefix(name, "ae"):
+			return PortClassAggregate
+		case strings.HasPrefix(name, "lo"):
+			return PortClassLoopback
+		case strings.HasPrefix(name, "tu"):
+			return PortClassTunnel
+		}
+	}
+	return PortClassOther
 }
 
-func getPortTable(snmp *gosnmp.GoSNMP, sysName string) (map[string]*Port, error) {
-	pdus, err := walkOIDs(snmp, []string{
+func getPortTable(ctx context.Context, snmp *gosnmp.GoSNMP, sysName, chassisID string) (map[string]*Port, error) {
+	pdus, err := walkOIDs(ctx, snmp, []string{
 		snmpPortMacAddressPrefix,
 		snmpPortNamePrefix,
+		snmpPortDescrPrefix,
 		snmpPortDescriptionPrefix,
+		snmpPortTypePrefix,
+		snmpPortAdminStatusPrefix,
 		snmpPortLinkStatusPrefix,
 		snmpPortSpeedPrefix,
 	})
@@ -59,13 +133,24 @@ func getPortTable(snmp *gosnmp.GoSNMP, sysName string) (map[string]*Port, error)
 		id := strings.TrimPrefix(pdu.Name, string(snmpPortMacAddressPrefix))
 		mac := net.HardwareAddr(pdu.Value.([]byte))
 		if mac.String() != unknownMacAddress {
-			tbl[id] = &Port{SystemName: sysName, MacAddress: mac.String()}
+			idx, _ := strconv.Atoi(strings.TrimPrefix(id, "."))
+			tbl[id] = &Port{SystemName: sysName, ChassisID: chassisID, IfIndex: idx, MacAddress: mac.String()}
+		}
+	}
+	for _, pdu := range pdus[snmpPortDescrPrefix] {
+		id := strings.TrimPrefix(pdu.Name, string(snmpPortDescrPrefix))
+		if port, ok := tbl[id]; ok {
+			port.IfDescr = string((pdu.Value).([]byte))
+			port.Name, port.NameSource = port.IfDescr, PortNameSourceIfDescr
 		}
 	}
+	//ifDescr is often a long vendor string, so ifName is preferred if it's set
 	for _, pdu := range pdus[snmpPortNamePrefix] {
 		id := strings.TrimPrefix(pdu.Name, string(snmpPortNamePrefix))
 		if port, ok := tbl[id]; ok {
-			port.Name = string((pdu.Value).([]byte))
+			if name := string((pdu.Value).([]byte)); name != "" {
+				port.Name, port.NameSource = name, PortNameSourceIfName
+			}
 		}
 	}
 	for _, pdu := range pdus[snmpPortDescriptionPrefix] {
@@ -74,6 +159,18 @@ func getPortTable(snmp *gosnmp.GoSNMP, sysName string) (map[string]*Port, error)
 			port.Description = string(pdu.Value.([]byte))
 		}
 	}
+	for _, pdu := range pdus[snmpPortTypePrefix] {
+		id := strings.TrimPrefix(pdu.Name, string(snmpPortTypePrefix))
+		if port, ok := tbl[id]; ok {
+			port.Type = pdu.Value.(int)
+		}
+	}
+	for _, pdu := range pdus[snmpPortAdminStatusPrefix] {
+		id := strings.TrimPrefix(pdu.Name, string(snmpPortAdminStatusPrefix))
+		if port, ok := tbl[id]; ok {
+			port.AdminStatus = LinkStatusType(pdu.Value.(int))
+		}
+	}
 	for _, pdu := range pdus[snmpPortLinkStatusPrefix] {
 		id := strings.TrimPrefix(pdu.Name, string(snmpPortLinkStatusPrefix))
 		if port, ok := tbl[id]; ok {
@@ -3,6 +3,7 @@ package snmp
 import (
 	"net"
 	"sync"
+	"time"
 
 	"github.com/korylprince/ipscan/resolve"
 )
@@ -13,7 +14,13 @@ type Resolve struct {
 	Hostname  string
 }
 
-func getResolves(resolver *resolve.Service, arps []*Arp) chan []*Resolve {
+type resolveResult struct {
+	resolves []*Resolve
+	duration time.Duration
+}
+
+func getResolves(resolver *resolve.Service, arps []*Arp) chan *resolveResult {
+	start := time.Now()
 	var resolves []*Resolve
 	mu := new(sync.Mutex)
 	wg := new(sync.WaitGroup)
@@ -21,8 +28,9 @@ func getResolves(resolver *resolve.Service, arps []*Arp) chan []*Resolve {
 	for _, arp := range arps {
 		go func(ip string) {
 			defer wg.Done()
+			//zoned addresses won't parse and link-local addresses don't have reverse records
 			addr := net.ParseIP(ip)
-			if addr == nil {
+			if addr == nil || addr.IsLinkLocalUnicast() {
 				return
 			}
 			host, err := resolver.LookupAddr(addr)
@@ -39,11 +47,12 @@ func getResolves(resolver *resolve.Service, arps []*Arp) chan []*Resolve {
 		}(arp.IPAddress)
 	}
 
-	c := make(chan []*Resolve)
+	//buffered so the goroutine doesn't leak if the result is abandoned
+	c := make(chan *resolveResult, 1)
 
 	go func() {
 		wg.Wait()
-		c <- resolves
+		c <- &resolveResult{resolves: resolves, duration: time.Since(start)}
 	}()
 
 	return c
@@ -0,0 +1,399 @@
+package snmp
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+const (
+	//ENTITY-SENSOR-MIB entPhySensorTable, indexed by entPhysicalIndex
+	snmpEntitySensorPrefix = ".1.3.6.1.2.1.99.1.1.1"
+	//CISCO-ENTITY-SENSOR-MIB entSensorValueTable, indexed by entPhysicalIndex, with the same columns as entPhySensorTable
+	snmpCiscoSensorPrefix = ".1.3.6.1.4.1.9.9.91.1.1.1.1"
+	//CISCO-ENTITY-SENSOR-MIB entSensorThresholdTable, indexed by entPhysicalIndex and threshold index
+	snmpCiscoSensorThresholdSeverityPrefix = ".1.3.6.1.4.1.9.9.91.1.2.1.1.2"
+	snmpCiscoSensorThresholdRelationPrefix = ".1.3.6.1.4.1.9.9.91.1.2.1.1.3"
+	snmpCiscoSensorThresholdValuePrefix    = ".1.3.6.1.4.1.9.9.91.1.2.1.1.4"
+	//JUNIPER-DOM-MIB jnxDomCurrentTable, indexed by ifIndex
+	snmpJuniperDOMPrefix = ".1.3.6.1.4.1.2636.3.60.1.1.1.1"
+
+	//entPhySensorTable columns
+	snmpSensorColumnType      = 1
+	snmpSensorColumnScale     = 2
+	snmpSensorColumnPrecision = 3
+	snmpSensorColumnValue     = 4
+	snmpSensorColumnStatus    = 5
+
+	//EntitySensorDataType
+	snmpSensorTypeVoltsDC = 4
+	snmpSensorTypeAmperes = 5
+	snmpSensorTypeWatts   = 6
+	snmpSensorTypeCelsius = 8
+	snmpSensorTypeDBm     = 14
+
+	//EntitySensorDataScale units(0)
+	snmpSensorScaleUnits = 9
+
+	//EntitySensorStatus. Some devices don't implement the status column, so a missing status is treated as ok
+	snmpSensorStatusMissing = 0
+	snmpSensorStatusOK      = 1
+
+	//SensorThresholdSeverity and SensorThresholdRelation
+	snmpCiscoThresholdSeverityMinor  = 10
+	snmpCiscoThresholdRelationLess   = 1
+	snmpCiscoThresholdRelationLessEq = 2
+)
+
+// Sensor types
+const (
+	SensorTypeTemperature = "temperature"
+	SensorTypeBiasCurrent = "bias_current"
+	SensorTypeTxPower     = "tx_power"
+	SensorTypeRxPower     = "rx_power"
+	SensorTypeVoltage     = "voltage"
+)
+
+// Sensor statuses
+const (
+	SensorStatusOK          = "ok"
+	SensorStatusLowWarning  = "low_warning"
+	SensorStatusHighWarning = "high_warning"
+	SensorStatusLowAlarm    = "low_alarm"
+	SensorStatusHighAlarm   = "high_alarm"
+	SensorStatusUnavailable = "unavailable"
+)
+
+// Sensor is a transceiver diagnostic reading. Temperatures are in celsius, bias current in mA, power in dBm and
+// voltage in volts. Thresholds are nil if the device doesn't report them. Unavailable is set if the device reports
+// the sensor as unavailable or nonoperational, in which case Value isn't meaningful
+type Sensor struct {
+	Port        *Port
+	Name        string
+	Type        string
+	Value       float64
+	LowAlarm    *float64
+	LowWarning  *float64
+	HighWarning *float64
+	HighAlarm   *float64
+	Unavailable bool
+}
+
+// Status returns unavailable if the sensor isn't operational, otherwise the most severe threshold the value crosses
+func (s *Sensor) Status() string {
+	switch {
+	case s.Unavailable:
+		return SensorStatusUnavailable
+	case s.HighAlarm != nil && s.Value > *s.HighAlarm:
+		return SensorStatusHighAlarm
+	case s.LowAlarm != nil && s.Value < *s.LowAlarm:
+		return SensorStatusLowAlarm
+	case s.HighWarning != nil && s.Value > *s.HighWarning:
+		return SensorStatusHighWarning
+	case s.LowWarning != nil && s.Value < *s.LowWarning:
+		return SensorStatusLowWarning
+	}
+	return SensorStatusOK
+}
+
+// entitySensor is a row from entPhySensorTable or entSensorValueTable
+type entitySensor struct {
+	typ       int
+	scale     int
+	precision int
+	value     int64
+	status    int
+}
+
+// convert scales a raw value from the sensor and converts it to the unit of its Sensor type
+func (e *entitySensor) convert(raw int64) float64 {
+	v := float64(raw) * math.Pow10((e.scale-snmpSensorScaleUnits)*3) / math.Pow10(e.precision)
+	switch e.typ {
+	case snmpSensorTypeAmperes:
+		return v * 1000
+	case snmpSensorTypeWatts:
+		//dBm of a zero reading is undefined; report the floor most optics use for no light
+		if v <= 0 {
+			return -40
+		}
+		return 10 * math.Log10(v*1000)
+	}
+	return v
+}
+
+// walkEntitySensors walks a table with entPhySensorTable's columns
+func walkEntitySensors(ctx context.Context, snmp *gosnmp.GoSNMP, prefix string) (map[string]*entitySensor, error) {
+	column := func(c int) string { return prefix + "." + strconv.Itoa(c) }
+	pdus, err := walkOIDs(ctx, snmp, []string{
+		column(snmpSensorColumnType),
+		column(snmpSensorColumnScale),
+		column(snmpSensorColumnPrecision),
+		column(snmpSensorColumnValue),
+		column(snmpSensorColumnStatus),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sensors := make(map[string]*entitySensor)
+	for _, pdu := range pdus[column(snmpSensorColumnType)] {
+		sensors[strings.TrimPrefix(pdu.Name, column(snmpSensorColumnType))] = &entitySensor{typ: pdu.Value.(int), scale: snmpSensorScaleUnits}
+	}
+	for _, pdu := range pdus[column(snmpSensorColumnScale)] {
+		if s, ok := sensors[strings.TrimPrefix(pdu.Name, column(snmpSensorColumnScale))]; ok {
+			s.scale = pdu.Value.(int)
+		}
+	}
+	for _, pdu := range pdus[column(snmpSensorColumnPrecision)] {
+		if s, ok := sensors[strings.TrimPrefix(pdu.Name, column(snmpSensorColumnPrecision))]; ok {
+			s.precision = pdu.Value.(int)
+		}
+	}
+	for _, pdu := range pdus[column(snmpSensorColumnValue)] {
+		if s, ok := sensors[strings.TrimPrefix(pdu.Name, column(snmpSensorColumnValue))]; ok {
+			s.value = gosnmp.ToBigInt(pdu.Value).Int64()
+		}
+	}
+	for _, pdu := range pdus[column(snmpSensorColumnStatus)] {
+		if s, ok := sensors[strings.TrimPrefix(pdu.Name, column(snmpSensorColumnStatus))]; ok {
+			s.status = pdu.Value.(int)
+		}
+	}
+
+	return sensors, nil
+}
+
+// sensorType returns the Sensor type of the entity sensor, using the entity name to tell transmit and receive power
+// apart, or an empty string if it isn't a transceiver diagnostic
+func sensorType(e *entitySensor, ent *Entity) string {
+	switch e.typ {
+	case snmpSensorTypeCelsius:
+		return SensorTypeTemperature
+	case snmpSensorTypeAmperes:
+		return SensorTypeBiasCurrent
+	case snmpSensorTypeVoltsDC:
+		return SensorTypeVoltage
+	case snmpSensorTypeWatts, snmpSensorTypeDBm:
+		name := strings.ToLower(ent.Name + " " + ent.Description)
+		switch {
+		case strings.Contains(name, "rx") || strings.Contains(name, "receive"):
+			return SensorTypeRxPower
+		case strings.Contains(name, "tx") || strings.Contains(name, "transmit"):
+			return SensorTypeTxPower
+		}
+	}
+	return ""
+}
+
+// getEntitySensors reads transceiver sensors from ENTITY-SENSOR-MIB and CISCO-ENTITY-SENSOR-MIB. Sensors are
+// correlated to ports through the entity containment tree, falling back to the entity names
+func getEntitySensors(ctx context.Context, snmp *gosnmp.GoSNMP, entities []*Entity, portTbl map[string]*Port) ([]*Sensor, error) {
+	entTbl := make(map[int]*Entity)
+	portChildren := make(map[int][]*Entity)
+	for _, e := range entities {
+		entTbl[e.Index] = e
+		if e.Class == "port" && e.Port != nil {
+			portChildren[e.ContainedIn] = append(portChildren[e.ContainedIn], e)
+		}
+	}
+	byName := make(map[string]*Port)
+	for _, p := range portTbl {
+		if p.IfDescr != "" {
+			byName[p.IfDescr] = p
+		}
+	}
+	for _, p := range portTbl {
+		byName[p.Name] = p
+	}
+
+	//port walks up the containment tree to the entity mapped to a port, e.g. sensor -> transceiver -> port.
+	//Cisco puts the port entity beside the sensors under the transceiver, so an ancestor with a single port entity
+	//also maps to that port. Otherwise the first word of the entity names is matched to ifName or ifDescr,
+	//e.g. "GigabitEthernet1/0/1 Receive Power Sensor"
+	port := func(ent *Entity) *Port {
+		for e, i := ent, 0; e != nil && i < 8; e, i = entTbl[e.ContainedIn], i+1 {
+			if e.Port != nil {
+				return e.Port
+			}
+			if c := portChildren[e.Index]; len(c) == 1 {
+				return c[0].Port
+			}
+		}
+		for e, i := ent, 0; e != nil && i < 8; e, i = entTbl[e.ContainedIn], i+1 {
+			if f := strings.Fields(e.Name); len(f) > 0 {
+				if p, ok := byName[f[0]]; ok {
+					return p
+				}
+			}
+		}
+		return nil
+	}
+
+	raw, err := walkEntitySensors(ctx, snmp, snmpEntitySensorPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to walk for entity sensors: %w", err)
+	}
+	//Cisco devices report the same sensors in both tables, but only the Cisco table has thresholds
+	cisco, err := walkEntitySensors(ctx, snmp, snmpCiscoSensorPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to walk for Cisco entity sensors: %w", err)
+	}
+	for id, s := range cisco {
+		raw[id] = s
+	}
+
+	sensors := make(map[string]*Sensor)
+	for id, e := range raw {
+		idx, err := strconv.Atoi(strings.TrimPrefix(id, "."))
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing id: %w", err)
+		}
+		ent, ok := entTbl[idx]
+		if !ok {
+			continue
+		}
+		p := port(ent)
+		typ := sensorType(e, ent)
+		if p == nil || typ == "" {
+			continue
+		}
+		sensors[id] = &Sensor{
+			Port:        p,
+			Name:        ent.Name,
+			Type:        typ,
+			Value:       e.convert(e.value),
+			Unavailable: e.status != snmpSensorStatusOK && e.status != snmpSensorStatusMissing,
+		}
+	}
+
+	if len(cisco) == 0 {
+		return sensorList(sensors), nil
+	}
+
+	pdus, err := walkOIDs(ctx, snmp, []string{
+		snmpCiscoSensorThresholdSeverityPrefix,
+		snmpCiscoSensorThresholdRelationPrefix,
+		snmpCiscoSensorThresholdValuePrefix,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to walk for Cisco sensor thresholds: %w", err)
+	}
+
+	severities := make(map[string]int)
+	for _, pdu := range pdus[snmpCiscoSensorThresholdSeverityPrefix] {
+		severities[strings.TrimPrefix(pdu.Name, snmpCiscoSensorThresholdSeverityPrefix)] = pdu.Value.(int)
+	}
+	relations := make(map[string]int)
+	for _, pdu := range pdus[snmpCiscoSensorThresholdRelationPrefix] {
+		relations[strings.TrimPrefix(pdu.Name, snmpCiscoSensorThresholdRelationPrefix)] = pdu.Value.(int)
+	}
+	for _, pdu := range pdus[snmpCiscoSensorThresholdValuePrefix] {
+		oid := strings.TrimPrefix(pdu.Name, snmpCiscoSensorThresholdValuePrefix)
+		id := oid[:strings.LastIndexByte(oid, '.')]
+		s, ok := sensors[id]
+		c, cok := cisco[id]
+		if !ok || !cok {
+			continue
+		}
+		v := c.convert(gosnmp.ToBigInt(pdu.Value).Int64())
+		low := relations[oid] == snmpCiscoThresholdRelationLess || relations[oid] == snmpCiscoThresholdRelationLessEq
+		//minor thresholds are warnings; major and critical thresholds are alarms
+		warning := severities[oid] <= snmpCiscoThresholdSeverityMinor
+		switch {
+		case low && warning:
+			s.LowWarning = &v
+		case low:
+			s.LowAlarm = &v
+		case warning:
+			s.HighWarning = &v
+		default:
+			s.HighAlarm = &v
+		}
+	}
+
+	return sensorList(sensors), nil
+}
+
+func sensorList(sensors map[string]*Sensor) []*Sensor {
+	list := make([]*Sensor, 0, len(sensors))
+	for _, s := range sensors {
+		list = append(list, s)
+	}
+	return list
+}
+
+// juniperDOMSensors are the readings in jnxDomCurrentTable. Each reading is followed by its high alarm, low alarm,
+// high warning and low warning threshold columns, starting at thresholds
+var juniperDOMSensors = []struct {
+	typ        string
+	column     int
+	thresholds int
+	divisor    float64
+}{
+	{SensorTypeRxPower, 5, 9, 100},
+	{SensorTypeBiasCurrent, 6, 13, 1000},
+	{SensorTypeTxPower, 7, 17, 100},
+	{SensorTypeTemperature, 8, 21, 1},
+}
+
+// getJuniperSensors reads transceiver sensors from JUNIPER-DOM-MIB
+func getJuniperSensors(ctx context.Context, snmp *gosnmp.GoSNMP, portTbl map[string]*Port) ([]*Sensor, error) {
+	column := func(c int) string { return snmpJuniperDOMPrefix + "." + strconv.Itoa(c) }
+
+	sensors := make([]*Sensor, 0)
+	for _, d := range juniperDOMSensors {
+		oids := []string{column(d.column)}
+		for c := d.thresholds; c < d.thresholds+4; c++ {
+			oids = append(oids, column(c))
+		}
+		pdus, err := walkOIDs(ctx, snmp, oids)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to walk for Juniper DOM sensors: %w", err)
+		}
+
+		thresholds := make(map[string][]*float64)
+		for c := 0; c < 4; c++ {
+			for _, pdu := range pdus[column(d.thresholds+c)] {
+				id := strings.TrimPrefix(pdu.Name, column(d.thresholds+c))
+				if thresholds[id] == nil {
+					thresholds[id] = make([]*float64, 4)
+				}
+				v := float64(gosnmp.ToBigInt(pdu.Value).Int64()) / d.divisor
+				thresholds[id][c] = &v
+			}
+		}
+
+		for _, pdu := range pdus[column(d.column)] {
+			id := strings.TrimPrefix(pdu.Name, column(d.column))
+			p, ok := portTbl[id]
+			if !ok {
+				continue
+			}
+			s := &Sensor{Port: p, Name: p.Name, Type: d.typ, Value: float64(gosnmp.ToBigInt(pdu.Value).Int64()) / d.divisor}
+			if t := thresholds[id]; t != nil {
+				s.HighAlarm, s.LowAlarm, s.HighWarning, s.LowWarning = t[0], t[1], t[2], t[3]
+			}
+			sensors = append(sensors, s)
+		}
+	}
+
+	return sensors, nil
+}
+
+func getSensors(ctx context.Context, snmp *gosnmp.GoSNMP, entities []*Entity, portTbl map[string]*Port) ([]*Sensor, error) {
+	sensors, err := getEntitySensors(ctx, snmp, entities, portTbl)
+	if err != nil {
+		return nil, err
+	}
+
+	juniper, err := getJuniperSensors(ctx, snmp, portTbl)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(sensors, juniper...), nil
+}
@@ -2,15 +2,20 @@
 package snmp
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/gosnmp/gosnmp"
 	"github.com/korylprince/ipscan/resolve"
 )
 
-const snmpSystemName = ".1.3.6.1.2.1.1.5.0"
+func getOIDs(ctx context.Context, snmp *gosnmp.GoSNMP, oids []string) (map[string]gosnmp.SnmpPDU, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to get OIDs %v: %w", oids, err)
+	}
 
-func getOIDs(snmp *gosnmp.GoSNMP, oids []string) (map[string]gosnmp.SnmpPDU, error) {
 	sOIDs := make([]string, 0, len(oids))
 	sOIDs = append(sOIDs, oids...)
 
@@ -30,9 +35,21 @@ func getOIDs(snmp *gosnmp.GoSNMP, oids []string) (map[string]gosnmp.SnmpPDU, err
 	return res, nil
 }
 
-func walkOIDs(snmp *gosnmp.GoSNMP, oids []string) (map[string][]gosnmp.SnmpPDU, error) {
+func walkOIDs(ctx context.Context, snmp *gosnmp.GoSNMP, oids []string) (map[string][]gosnmp.SnmpPDU, error) {
 	pdus := make(map[string][]gosnmp.SnmpPDU)
 	for _, oid := range oids {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("Failed to walk OID %v: %w", oid, err)
+		}
+		//GetBulk doesn't exist in SNMPv1, so fall back to GetNext
+		if snmp.Version == gosnmp.Version1 {
+			p, err := snmp.WalkAll(oid)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to Walk OID %v: %w", oid, err)
+			}
+			pdus[oid] = p
+			continue
+		}
 		p, err := snmp.BulkWalkAll(oid)
 		if err != nil {
 			return nil, fmt.Errorf("Failed to BulkWalk OID %v: %w", oid, err)
@@ -43,74 +60,189 @@ func walkOIDs(snmp *gosnmp.GoSNMP, oids []string) (map[string][]gosnmp.SnmpPDU,
 	return pdus, nil
 }
 
-// NetInfo is information from a device
+// Collector names
+const (
+	CollectorARP        = "arp"
+	CollectorPort       = "port"
+	CollectorLLDP       = "lldp"
+	CollectorCDP        = "cdp"
+	CollectorMacAddress = "mac_address"
+	CollectorEntity     = "entity"
+	CollectorSensor     = "sensor"
+	CollectorCounter    = "counter"
+	CollectorResolve    = "resolve"
+)
+
+// CollectorStats are statistics for a single collector on a device.
+// PDUs is the number of SNMP responses received, and is always 0 for CollectorResolve
+type CollectorStats struct {
+	Collector string
+	Duration  time.Duration
+	PDUs      int
+}
+
+// CollectorError is an error from a single collector on a device
+type CollectorError struct {
+	SystemName string
+	ChassisID  string
+	Collector  string
+	Err        error
+}
+
+func (e *CollectorError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Collector, e.Err)
+}
+
+func (e *CollectorError) Unwrap() error {
+	return e.Err
+}
+
+// MarshalJSON implements json.Marshaler
+func (e *CollectorError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		SystemName string
+		ChassisID  string
+		Collector  string
+		Err        string
+	}{e.SystemName, e.ChassisID, e.Collector, e.Err.Error()})
+}
+
+// NetInfo is information from a device. Errors contains the collectors that failed;
+// the other fields contain whatever was collected successfully
 type NetInfo struct {
+	System       *SystemInfo
 	Ports        []*Port
 	LLDPs        []*LLDP
 	MacAddresses []*MacAddress
 	Arps         []*Arp
 	Resolves     []*Resolve
+	Entities     []*Entity
+	Sensors      []*Sensor
+	Errors       []*CollectorError
+	Stats        []*CollectorStats
 }
 
 // System is a device
 type System struct {
-	Hostname          string `json:"hostname"`
-	Port              uint16 `json:"port"`
+	ID                int64         `json:"id"`
+	Hostname          string        `json:"hostname"`
+	Port              uint16        `json:"port"`
+	PollInterval      time.Duration `json:"poll_interval"`
+	Failures          int           `json:"consecutive_failures"`
+	CollectOptics     bool          `json:"collect_optics"`
 	*ConnectionConfig `json:"connection"`
 }
 
-// Read retrieves information from network devices
-func (s *System) Read(resolver *resolve.Service) (*NetInfo, error) {
+// Read retrieves information from network devices. An error is only returned if the device can't be read at all;
+// errors from individual collectors are returned in NetInfo.Errors. If ctx is cancelled, in-flight requests are
+// abandoned and the remaining collectors fail
+func (s *System) Read(ctx context.Context, resolver *resolve.Service) (*NetInfo, error) {
 	snmp := s.ConnectionConfig.New(s.Hostname, s.Port)
+	snmp.Context = ctx
+
+	pdus := 0
+	snmp.OnRecv = func(*gosnmp.GoSNMP) { pdus++ }
 
 	if err := snmp.Connect(); err != nil {
 		return nil, fmt.Errorf("Failed to open SNMP connection: %w", err)
 	}
 	defer snmp.Conn.Close()
 
-	arps, err := getARPs(snmp)
+	sysInfo, err := getSystemInfo(ctx, snmp)
 	if err != nil {
-		return nil, fmt.Errorf("Failed getting ARP info: %w", err)
+		return nil, err
+	}
+	sysInfo.ChassisID = getChassisID(ctx, snmp)
+	sysName, chassisID := sysInfo.Name, sysInfo.ChassisID
+
+	info := &NetInfo{System: sysInfo}
+	collectorErr := func(collector string, err error) {
+		info.Errors = append(info.Errors, &CollectorError{SystemName: sysName, ChassisID: chassisID, Collector: collector, Err: err})
+	}
+	//collect runs f and records its statistics
+	collect := func(collector string, f func() error) error {
+		start, startPDUs := time.Now(), pdus
+		err := f()
+		info.Stats = append(info.Stats, &CollectorStats{Collector: collector, Duration: time.Since(start), PDUs: pdus - startPDUs})
+		return err
 	}
 
+	var arps []*Arp
+	if err = collect(CollectorARP, func() (err error) { arps, err = getARPs(ctx, snmp); return }); err != nil {
+		collectorErr(CollectorARP, fmt.Errorf("Failed getting ARP info: %w", err))
+	}
+	info.Arps = arps
+
 	resChan := getResolves(resolver, arps)
+	//wait for resolves to finish before returning, even on failure, unless ctx is cancelled
+	defer func() {
+		select {
+		case res := <-resChan:
+			info.Resolves = res.resolves
+			info.Stats = append(info.Stats, &CollectorStats{Collector: CollectorResolve, Duration: res.duration})
+		case <-ctx.Done():
+			collectorErr(CollectorResolve, fmt.Errorf("Failed getting resolves: %w", ctx.Err()))
+		}
+	}()
+
+	var portTbl map[string]*Port
+	if err = collect(CollectorPort, func() (err error) { portTbl, err = getPortTable(ctx, snmp, sysName, chassisID); return }); err != nil {
+		err = fmt.Errorf("Failed getting port table: %w", err)
+		collectorErr(CollectorPort, err)
+		//LLDP, CDP, MAC addresses, entities and counters can't be located without ports
+		collectorErr(CollectorLLDP, err)
+		collectorErr(CollectorCDP, err)
+		collectorErr(CollectorMacAddress, err)
+		collectorErr(CollectorEntity, err)
+		collectorErr(CollectorCounter, err)
+		if s.CollectOptics {
+			collectorErr(CollectorSensor, err)
+		}
+		return info, nil
+	}
 
-	pdusGet, err := getOIDs(snmp, []string{
-		snmpSystemName,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("Failed to get system name: %w", err)
+	for _, a := range arps {
+		a.Port = portTbl[a.ifIndex]
+	}
+
+	if err = collect(CollectorCounter, func() error { return getPortCounters(ctx, snmp, portTbl) }); err != nil {
+		collectorErr(CollectorCounter, fmt.Errorf("Failed getting port counters: %w", err))
 	}
-	sysName := ""
-	if pdu, ok := pdusGet[snmpSystemName]; ok {
-		sysName = string(pdu.Value.([]byte))
+
+	if err = collect(CollectorLLDP, func() (err error) { info.LLDPs, err = getLLDPs(ctx, snmp, portTbl); return }); err != nil {
+		collectorErr(CollectorLLDP, fmt.Errorf("Failed getting LLDP info: %w", err))
 	}
 
-	portTbl, err := getPortTable(snmp, sysName)
-	if err != nil {
-		return nil, fmt.Errorf("Failed getting port table: %w", err)
+	if cdpSupported(sysInfo.ObjectID) {
+		var cdps []*LLDP
+		if err = collect(CollectorCDP, func() (err error) { cdps, err = getCDPs(ctx, snmp, portTbl); return }); err != nil {
+			collectorErr(CollectorCDP, fmt.Errorf("Failed getting CDP info: %w", err))
+		}
+		info.LLDPs = append(info.LLDPs, cdps...)
 	}
 
-	lldps, err := getLLDPs(snmp, portTbl)
-	if err != nil {
-		return nil, fmt.Errorf("Failed getting LLDP info: %w", err)
+	if err = collect(CollectorMacAddress, func() (err error) {
+		info.MacAddresses, err = getMacAddresses(ctx, snmp, s.ConnectionConfig, portTbl)
+		return
+	}); err != nil {
+		collectorErr(CollectorMacAddress, fmt.Errorf("Failed getting MAC Address info: %w", err))
 	}
 
-	macs, err := getMacAddresses(snmp, portTbl)
-	if err != nil {
-		return nil, fmt.Errorf("Failed getting MAC Address info: %w", err)
+	if err = collect(CollectorEntity, func() (err error) { info.Entities, err = getEntities(ctx, snmp, portTbl); return }); err != nil {
+		collectorErr(CollectorEntity, fmt.Errorf("Failed getting entity info: %w", err))
+	}
+
+	//transceiver sensors are only collected if enabled, since they add several walks per poll
+	if s.CollectOptics {
+		if err = collect(CollectorSensor, func() (err error) { info.Sensors, err = getSensors(ctx, snmp, info.Entities, portTbl); return }); err != nil {
+			collectorErr(CollectorSensor, fmt.Errorf("Failed getting sensor info: %w", err))
+		}
 	}
 
-	ports := make([]*Port, 0, len(portTbl))
+	info.Ports = make([]*Port, 0, len(portTbl))
 	for _, p := range portTbl {
-		ports = append(ports, p)
+		info.Ports = append(info.Ports, p)
 	}
 
-	return &NetInfo{
-		Ports:        ports,
-		MacAddresses: macs,
-		Arps:         arps,
-		LLDPs:        lldps,
-		Resolves:     <-resChan,
-	}, nil
+	return info, nil
 }
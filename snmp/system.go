@@ -0,0 +1,68 @@
+package snmp
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// SNMPv2-MIB system group
+const (
+	snmpSystemDescription = ".1.3.6.1.2.1.1.1.0"
+	snmpSystemObjectID    = ".1.3.6.1.2.1.1.2.0"
+	snmpSystemUpTime      = ".1.3.6.1.2.1.1.3.0"
+	snmpSystemContact     = ".1.3.6.1.2.1.1.4.0"
+	snmpSystemName        = ".1.3.6.1.2.1.1.5.0"
+	snmpSystemLocation    = ".1.3.6.1.2.1.1.6.0"
+)
+
+// SystemInfo is the inventory from the system group of a device
+type SystemInfo struct {
+	Name        string
+	ChassisID   string
+	Description string
+	ObjectID    string
+	UpTime      time.Duration
+	Location    string
+	Contact     string
+}
+
+func pduString(pdu gosnmp.SnmpPDU) string {
+	switch v := pdu.Value.(type) {
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	}
+	return ""
+}
+
+func getSystemInfo(ctx context.Context, snmp *gosnmp.GoSNMP) (*SystemInfo, error) {
+	pdus, err := getOIDs(ctx, snmp, []string{
+		snmpSystemDescription,
+		snmpSystemObjectID,
+		snmpSystemUpTime,
+		snmpSystemContact,
+		snmpSystemName,
+		snmpSystemLocation,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get system group: %w", err)
+	}
+
+	info := &SystemInfo{
+		Name:        pduString(pdus[snmpSystemName]),
+		Description: pduString(pdus[snmpSystemDescription]),
+		ObjectID:    pduString(pdus[snmpSystemObjectID]),
+		Location:    pduString(pdus[snmpSystemLocation]),
+		Contact:     pduString(pdus[snmpSystemContact]),
+	}
+	if pdu := pdus[snmpSystemUpTime]; pdu.Type == gosnmp.TimeTicks {
+		//TimeTicks are hundredths of a second
+		info.UpTime = time.Duration(gosnmp.ToBigInt(pdu.Value).Int64()) * 10 * time.Millisecond
+	}
+
+	return info, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const spoolExt = ".json"
+
+// Spool persists Journals that failed to insert so they can be replayed in order later
+type Spool struct {
+	path    string
+	maxSize int64
+	maxAge  time.Duration
+}
+
+// NewSpool returns a new Spool in the given directory. If maxSize or maxAge are greater than 0,
+// the oldest Journals are evicted to keep the spool under the limits
+func NewSpool(path string, maxSize int64, maxAge time.Duration) (*Spool, error) {
+	if err := os.MkdirAll(path, 0o700); err != nil {
+		return nil, fmt.Errorf("Unable to create spool directory: %w", err)
+	}
+	return &Spool{path: path, maxSize: maxSize, maxAge: maxAge}, nil
+}
+
+type spoolFile struct {
+	path string
+	time time.Time
+	size int64
+}
+
+// files returns the spooled files, oldest first
+func (s *Spool) files() ([]*spoolFile, error) {
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read spool directory: %w", err)
+	}
+
+	files := make([]*spoolFile, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), spoolExt) {
+			continue
+		}
+		nano, err := strconv.ParseInt(strings.TrimSuffix(e.Name(), spoolExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, fmt.Errorf("Unable to stat spool file: %w", err)
+		}
+		files = append(files, &spoolFile{path: filepath.Join(s.path, e.Name()), time: time.Unix(0, nano), size: info.Size()})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].time.Before(files[j].time) })
+
+	return files, nil
+}
+
+// Len returns the number of spooled Journals
+func (s *Spool) Len() (int, error) {
+	files, err := s.files()
+	return len(files), err
+}
+
+// Write persists the Journal to the spool
+func (s *Spool) Write(j *Journal) error {
+	if err := s.write(strconv.FormatInt(time.Now().UnixNano(), 10)+spoolExt, j); err != nil {
+		return err
+	}
+	return s.evict()
+}
+
+// write atomically writes the Journal to the spool file with the given name
+func (s *Spool) write(name string, j *Journal) error {
+	tmp := filepath.Join(s.path, "."+name)
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("Unable to create spool file: %w", err)
+	}
+	if err = json.NewEncoder(f).Encode(j); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("Unable to write spool file: %w", err)
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("Unable to write spool file: %w", err)
+	}
+	if err = os.Rename(tmp, filepath.Join(s.path, name)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("Unable to rename spool file: %w", err)
+	}
+
+	return nil
+}
+
+// evict removes Journals older than maxAge, then the oldest Journals until the spool is smaller than maxSize
+func (s *Spool) evict() error {
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	for _, f := range files {
+		size += f.size
+	}
+
+	for _, f := range files {
+		expired := s.maxAge > 0 && time.Since(f.time) > s.maxAge
+		full := s.maxSize > 0 && size > s.maxSize
+		if !expired && !full {
+			break
+		}
+		if err = os.Remove(f.path); err != nil {
+			return fmt.Errorf("Unable to evict spool file: %w", err)
+		}
+		log.Printf("WARNING: Evicted spooled journal from %s\n", f.time.Format(time.RFC3339))
+		size -= f.size
+	}
+
+	return nil
+}
+
+// Replay inserts the spooled Journals in order, removing each after it's inserted. Replay stops at the first error.
+// If a Journal is partially inserted, only the failed records are kept
+func (s *Spool) Replay(ctx context.Context, insert func(context.Context, *Journal) (int, error)) (int, error) {
+	if err := s.evict(); err != nil {
+		return 0, err
+	}
+
+	files, err := s.files()
+	if err != nil {
+		return 0, err
+	}
+
+	rows := 0
+	for _, f := range files {
+		//journals spooled by older versions may be missing record types
+		j := NewJournal()
+		buf, err := os.ReadFile(f.path)
+		if err != nil {
+			return rows, fmt.Errorf("Unable to read spool file: %w", err)
+		}
+		if err = json.Unmarshal(buf, j); err != nil {
+			log.Printf("WARNING: Removing unreadable spool file %s: %v\n", f.path, err)
+			os.Remove(f.path)
+			continue
+		}
+
+		n, err := insert(ctx, j)
+		rows += n
+		if err != nil {
+			if failed := FailedJournal(j, err); failed != j {
+				if werr := s.write(filepath.Base(f.path), failed); werr != nil {
+					log.Printf("WARNING: Unable to update spool file %s: %v\n", f.path, werr)
+				}
+			}
+			return rows, fmt.Errorf("Unable to insert journal from %s: %w", f.time.Format(time.RFC3339), err)
+		}
+
+		if err = os.Remove(f.path); err != nil {
+			return rows, fmt.Errorf("Unable to remove spool file: %w", err)
+		}
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/korylprince/snmp-tracker/snmp"
+)
+
+const (
+	snmpTrapOID = ".1.3.6.1.6.3.1.1.4.1.0"
+
+	snmpTrapGenericPrefix       = ".1.3.6.1.6.3.1.1.5"
+	snmpTrapLinkDown            = ".1.3.6.1.6.3.1.1.5.3"
+	snmpTrapLinkUp              = ".1.3.6.1.6.3.1.1.5.4"
+	snmpTrapLLDPRemTablesChange = ".1.0.8802.1.1.2.0.0.1"
+
+	// CISCO-MAC-NOTIFICATION-MIB and HP-ICF-MAC-NOTIFY-MIB notifications
+	snmpTrapCiscoMacNotificationPrefix = ".1.3.6.1.4.1.9.9.215.2.0."
+	snmpTrapHPMacNotificationPrefix    = ".1.3.6.1.4.1.11.2.14.11.5.1.102.0."
+
+	snmpTrapV1EnterpriseSpecific = 6
+)
+
+// trapOID returns the notification OID of the trap
+func trapOID(pkt *gosnmp.SnmpPacket) string {
+	if pkt.Version == gosnmp.Version1 {
+		//see RFC 3584 section 3.1
+		if pkt.GenericTrap == snmpTrapV1EnterpriseSpecific {
+			return fmt.Sprintf("%s.0.%d", pkt.Enterprise, pkt.SpecificTrap)
+		}
+		return fmt.Sprintf("%s.%d", snmpTrapGenericPrefix, pkt.GenericTrap+1)
+	}
+
+	for _, v := range pkt.Variables {
+		if v.Name == snmpTrapOID {
+			if oid, ok := v.Value.(string); ok {
+				return oid
+			}
+		}
+	}
+
+	return ""
+}
+
+// trapTriggersPoll returns true if the notification means the port or MAC address tables have changed
+func trapTriggersPoll(oid string) bool {
+	switch {
+	case oid == snmpTrapLinkDown, oid == snmpTrapLinkUp, oid == snmpTrapLLDPRemTablesChange:
+		return true
+	case strings.HasPrefix(oid, snmpTrapCiscoMacNotificationPrefix), strings.HasPrefix(oid, snmpTrapHPMacNotificationPrefix):
+		return true
+	}
+	return false
+}
+
+// TrapReceiver listens for traps and informs from known systems and triggers an out-of-cycle poll of the sending system
+type TrapReceiver struct {
+	scheduler *Scheduler
+	community string
+	delay     time.Duration
+
+	mu      *sync.Mutex
+	systems map[string]*snmp.System
+}
+
+// NewTrapReceiver returns a new TrapReceiver. Only SNMPv1 and SNMPv2c traps are accepted.
+// If community is not empty, traps with a different community are ignored.
+// Polls are triggered through scheduler and delayed by delay so that multiple traps from the same system cause a single poll
+func NewTrapReceiver(scheduler *Scheduler, community string, delay time.Duration) *TrapReceiver {
+	return &TrapReceiver{
+		scheduler: scheduler,
+		community: community,
+		delay:     delay,
+		mu:        new(sync.Mutex),
+		systems:   make(map[string]*snmp.System),
+	}
+}
+
+// SetSystems sets the known systems. Traps are matched to systems by the addresses their hostnames resolve to
+func (t *TrapReceiver) SetSystems(systems []*snmp.System) {
+	addrs := make(map[string]*snmp.System)
+	for _, s := range systems {
+		if ip := net.ParseIP(s.Hostname); ip != nil {
+			addrs[ip.String()] = s
+			continue
+		}
+		ips, err := net.LookupIP(s.Hostname)
+		if err != nil {
+			log.Printf("WARNING: Unable to resolve system %s for traps: %v\n", s.Hostname, err)
+			continue
+		}
+		for _, ip := range ips {
+			addrs[ip.String()] = s
+		}
+	}
+
+	t.mu.Lock()
+	t.systems = addrs
+	t.mu.Unlock()
+}
+
+// Listen listens for traps on addr
+func (t *TrapReceiver) Listen(addr string) error {
+	l := gosnmp.NewTrapListener()
+	l.Params = gosnmp.Default
+	l.OnNewTrap = t.handle
+	return l.Listen(addr)
+}
+
+func (t *TrapReceiver) handle(pkt *gosnmp.SnmpPacket, addr *net.UDPAddr) {
+	//the listener has no USM parameters, so SNMPv3 traps can't be authenticated
+	if pkt.Version == gosnmp.Version3 {
+		log.Printf("WARNING: Ignoring unsupported SNMPv3 trap from %s\n", addr.IP)
+		return
+	}
+	if t.community != "" && pkt.Community != t.community {
+		log.Printf("WARNING: Ignoring trap from %s with invalid community\n", addr.IP)
+		return
+	}
+
+	t.mu.Lock()
+	sys, ok := t.systems[addr.IP.String()]
+	if !ok && pkt.AgentAddress != "" {
+		sys, ok = t.systems[pkt.AgentAddress]
+	}
+	t.mu.Unlock()
+
+	if !ok {
+		log.Printf("WARNING: Ignoring trap from unknown system %s\n", addr.IP)
+		return
+	}
+
+	oid := trapOID(pkt)
+	if !trapTriggersPoll(oid) {
+		return
+	}
+
+	t.schedule(sys, oid)
+}
+
+func (t *TrapReceiver) schedule(sys *snmp.System, oid string) {
+	if t.scheduler.Trigger(sys, t.delay) {
+		log.Printf("INFO: Received trap %s from %s, polling within %v\n", oid, sys.Hostname, t.delay)
+	}
+}